@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+)
+
+func init() {
+	register(func(h handler) Check { return backtrackCheck{h} })
+}
+
+type backtrackCheck struct{ h handler }
+
+func (backtrackCheck) ID() string { return "backtrack" }
+func (backtrackCheck) Description() string {
+	return "backtrack is enabled with a long enough window and has not failed"
+}
+func (backtrackCheck) Severity() Severity { return SeverityWarning }
+
+func (c backtrackCheck) Run(ctx context.Context) (findings []Finding, err error) {
+	cluster := c.h.dbInfo.get().Cluster
+	min := time.Duration(c.h.policy.MinBacktrackWindowHours) * time.Hour
+	window := time.Duration(aws.Int64Value(cluster.BacktrackWindow)) * time.Second
+
+	if window == 0 {
+		if min > 0 {
+			findings = append(findings, newFinding(c, "BacktrackWindow", "backtrack is disabled"))
+		}
+		return findings, nil
+	}
+	if window < min {
+		findings = append(findings, newFinding(c, "BacktrackWindow", "backtrack window is %s, policy requires %s", window, min))
+	}
+
+	backtracks, err := c.h.backtracks(ctx)
+	if err != nil {
+		return findings, err
+	}
+	for _, v := range backtracks {
+		if aws.StringValue(v.Status) == "FAILED" {
+			findings = append(findings, newFinding(c, aws.StringValue(v.BacktrackIdentifier), "backtrack to %s requested %s failed",
+				aws.TimeValue(v.BacktrackTo).Format(time.RFC3339),
+				aws.TimeValue(v.BacktrackRequestCreationTime).Format(time.RFC3339)))
+		}
+	}
+	return findings, nil
+}
+
+// backtracks lists the backtrack history of the cluster
+func (h handler) backtracks(ctx context.Context) (backtracks []rds.DBClusterBacktrack, err error) {
+	err = h.probe("backtracks", &backtracks, func() error {
+		rdsapi := rds.New(h.AWSCfg)
+		input := &rds.DescribeDBClusterBacktracksInput{
+			DBClusterIdentifier: h.dbInfo.get().Cluster.DBClusterIdentifier,
+		}
+		// the SDK has no paginator for backtracks, follow the marker by hand
+		for {
+			resp, err := rdsapi.DescribeDBClusterBacktracksRequest(input).Send(ctx)
+			if err != nil {
+				return fmt.Errorf("failed to describe backtracks: %w", err)
+			}
+			backtracks = append(backtracks, resp.DBClusterBacktracks...)
+			if aws.StringValue(resp.Marker) == "" {
+				break
+			}
+			input.Marker = resp.Marker
+		}
+		return nil
+	})
+	return backtracks, err
+}
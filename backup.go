@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func init() {
+	register(func(h handler) Check { return backupCheck{h} })
+}
+
+const (
+	minutesPerDay  = 24 * 60
+	minutesPerWeek = 7 * minutesPerDay
+)
+
+var weekdays = []string{"mon", "tue", "wed", "thu", "fri", "sat", "sun"}
+
+// window is a span of minutes, end is past start when it wraps midnight
+type window struct {
+	start, end int
+}
+
+// parseDailyWindow parses the hh24:mi-hh24:mi UTC format of PreferredBackupWindow
+func parseDailyWindow(s string) (w window, err error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		return w, fmt.Errorf("malformed window %q", s)
+	}
+	w.start, err = parseClock(parts[0])
+	if err != nil {
+		return w, err
+	}
+	w.end, err = parseClock(parts[1])
+	if err != nil {
+		return w, err
+	}
+	if w.end <= w.start {
+		w.end += minutesPerDay
+	}
+	return w, nil
+}
+
+// parseWeeklyWindow parses the ddd:hh24:mi-ddd:hh24:mi UTC format of
+// PreferredMaintenanceWindow into minutes since Monday midnight
+func parseWeeklyWindow(s string) (w window, err error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		return w, fmt.Errorf("malformed window %q", s)
+	}
+	w.start, err = parseWeekClock(parts[0])
+	if err != nil {
+		return w, err
+	}
+	w.end, err = parseWeekClock(parts[1])
+	if err != nil {
+		return w, err
+	}
+	if w.end <= w.start {
+		w.end += minutesPerWeek
+	}
+	return w, nil
+}
+
+func parseClock(s string) (int, error) {
+	var hh, mm int
+	_, err := fmt.Sscanf(s, "%d:%d", &hh, &mm)
+	if err != nil || hh < 0 || hh > 23 || mm < 0 || mm > 59 {
+		return 0, fmt.Errorf("malformed time %q", s)
+	}
+	return hh*60 + mm, nil
+}
+
+func parseWeekClock(s string) (int, error) {
+	if len(s) < 4 || s[3] != ':' {
+		return 0, fmt.Errorf("malformed time %q", s)
+	}
+	for i, day := range weekdays {
+		if strings.EqualFold(s[:3], day) {
+			m, err := parseClock(s[4:])
+			return i*minutesPerDay + m, err
+		}
+	}
+	return 0, fmt.Errorf("malformed day %q", s)
+}
+
+// overlaps reports whether two windows repeating every period intersect
+func overlaps(a, b window, period int) bool {
+	for _, shift := range []int{-period, 0, period} {
+		if a.start < b.end+shift && b.start+shift < a.end {
+			return true
+		}
+	}
+	return false
+}
+
+// weekly repeats a daily window on every day of the week
+func (w window) weekly() (ws []window) {
+	for day := 0; day < 7; day++ {
+		ws = append(ws, window{w.start + day*minutesPerDay, w.end + day*minutesPerDay})
+	}
+	return ws
+}
+
+type backupCheck struct{ h handler }
+
+func (backupCheck) ID() string { return "backup" }
+func (backupCheck) Description() string {
+	return "backups are retained long enough and taken outside maintenance and business hours"
+}
+func (backupCheck) Severity() Severity { return SeverityWarning }
+
+func (c backupCheck) Run(ctx context.Context) (findings []Finding, err error) {
+	cluster := c.h.dbInfo.get().Cluster
+	p := c.h.policy
+
+	retention := aws.Int64Value(cluster.BackupRetentionPeriod)
+	if retention < p.MinBackupRetentionDays {
+		findings = append(findings, newFinding(c, "BackupRetentionPeriod", "backups are retained for %d days, policy requires %d", retention, p.MinBackupRetentionDays))
+	}
+
+	backupWindow := aws.StringValue(cluster.PreferredBackupWindow)
+	backup, err := parseDailyWindow(backupWindow)
+	if err != nil {
+		return append(findings, newFinding(c, "PreferredBackupWindow", "%s", err).withKind("invalid")), nil
+	}
+
+	maintenanceWindow := aws.StringValue(cluster.PreferredMaintenanceWindow)
+	maintenance, err := parseWeeklyWindow(maintenanceWindow)
+	if err != nil {
+		findings = append(findings, newFinding(c, "PreferredMaintenanceWindow", "%s", err))
+	} else {
+		for _, b := range backup.weekly() {
+			if overlaps(b, maintenance, minutesPerWeek) {
+				findings = append(findings, newFinding(c, "PreferredBackupWindow", "backup window %s overlaps maintenance window %s", backupWindow, maintenanceWindow).withKind("maintenance"))
+				break
+			}
+		}
+	}
+
+	if p.BusinessHours != "" {
+		business, err := parseDailyWindow(p.BusinessHours)
+		if err != nil {
+			return nil, fmt.Errorf("policy business_hours: %w", err)
+		}
+		if overlaps(backup, business, minutesPerDay) {
+			findings = append(findings, newFinding(c, "PreferredBackupWindow", "backup window %s overlaps business hours %s UTC", backupWindow, p.BusinessHours).withKind("business_hours"))
+		}
+	}
+	return findings, nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import "testing"
+
+func TestParseDailyWindow(t *testing.T) {
+	tests := []struct {
+		s    string
+		want window
+	}{
+		{"03:00-03:30", window{180, 210}},
+		{"00:00-23:59", window{0, 1439}},
+		// wraps midnight
+		{"23:30-00:30", window{1410, 1470}},
+		{"12:00-12:00", window{720, 720 + minutesPerDay}},
+	}
+	for _, tt := range tests {
+		got, err := parseDailyWindow(tt.s)
+		if err != nil || got != tt.want {
+			t.Errorf("parseDailyWindow(%q) = %v, %v, want %v", tt.s, got, err, tt.want)
+		}
+	}
+	for _, s := range []string{"", "03:00", "24:00-01:00", "03:60-04:00", "3am-4am"} {
+		if _, err := parseDailyWindow(s); err == nil {
+			t.Errorf("parseDailyWindow(%q) succeeded, want an error", s)
+		}
+	}
+}
+
+func TestParseWeeklyWindow(t *testing.T) {
+	tests := []struct {
+		s    string
+		want window
+	}{
+		{"mon:00:00-mon:00:30", window{0, 30}},
+		{"wed:03:00-wed:03:30", window{2*minutesPerDay + 180, 2*minutesPerDay + 210}},
+		{"Sat:22:00-Sat:23:00", window{5*minutesPerDay + 1320, 5*minutesPerDay + 1380}},
+		// wraps Sunday to Monday
+		{"sun:23:30-mon:00:30", window{6*minutesPerDay + 1410, minutesPerWeek + 30}},
+	}
+	for _, tt := range tests {
+		got, err := parseWeeklyWindow(tt.s)
+		if err != nil || got != tt.want {
+			t.Errorf("parseWeeklyWindow(%q) = %v, %v, want %v", tt.s, got, err, tt.want)
+		}
+	}
+	for _, s := range []string{"", "mon:00:00", "xyz:00:00-mon:00:30", "mon-00:00-mon:00:30", "mon:25:00-mon:26:00"} {
+		if _, err := parseWeeklyWindow(s); err == nil {
+			t.Errorf("parseWeeklyWindow(%q) succeeded, want an error", s)
+		}
+	}
+}
+
+func TestBackupOverlapsMaintenance(t *testing.T) {
+	tests := []struct {
+		backup, maintenance string
+		want                bool
+	}{
+		{"03:00-03:30", "wed:03:15-wed:03:45", true},
+		{"03:00-03:30", "wed:03:30-wed:04:00", false},
+		{"03:00-03:30", "wed:02:30-wed:03:00", false},
+		// the backup window wraps midnight into the maintenance window
+		{"23:45-00:15", "tue:00:00-tue:00:30", true},
+		// the maintenance window wraps Sunday to Monday
+		{"00:00-00:30", "sun:23:30-mon:00:15", true},
+		{"23:00-23:20", "sun:23:30-mon:00:15", false},
+		{"00:20-00:50", "sun:23:30-mon:00:15", false},
+		// both wrap
+		{"23:50-00:10", "sun:23:30-mon:00:15", true},
+	}
+	for _, tt := range tests {
+		backup, err := parseDailyWindow(tt.backup)
+		if err != nil {
+			t.Fatal(err)
+		}
+		maintenance, err := parseWeeklyWindow(tt.maintenance)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := false
+		for _, b := range backup.weekly() {
+			got = got || overlaps(b, maintenance, minutesPerWeek)
+		}
+		if got != tt.want {
+			t.Errorf("backup %s overlaps maintenance %s = %v, want %v", tt.backup, tt.maintenance, got, tt.want)
+		}
+	}
+}
+
+func TestOverlapsBusinessHours(t *testing.T) {
+	tests := []struct {
+		backup, business string
+		want             bool
+	}{
+		{"03:00-03:30", "09:00-17:00", false},
+		{"16:30-17:30", "09:00-17:00", true},
+		{"17:00-17:30", "09:00-17:00", false},
+		// business hours wrap midnight
+		{"00:30-01:00", "22:00-02:00", true},
+		{"02:00-02:30", "22:00-02:00", false},
+	}
+	for _, tt := range tests {
+		backup, err := parseDailyWindow(tt.backup)
+		if err != nil {
+			t.Fatal(err)
+		}
+		business, err := parseDailyWindow(tt.business)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := overlaps(backup, business, minutesPerDay); got != tt.want {
+			t.Errorf("backup %s overlaps business hours %s = %v, want %v", tt.backup, tt.business, got, tt.want)
+		}
+	}
+}
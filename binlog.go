@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	register(func(h handler) Check { return binlogCheck{h} })
+}
+
+type binaryLog struct {
+	LogName  string `db:"Log_name"`
+	FileSize int64  `db:"File_size"`
+}
+
+type masterStatus struct {
+	File     string `db:"File"`
+	Position int64  `db:"Position"`
+}
+
+type rdsConfiguration struct {
+	Name        string         `db:"name"`
+	Value       sql.NullString `db:"value"`
+	Description string         `db:"description"`
+}
+
+type binlogInfo struct {
+	Format string
+	Files  []binaryLog
+	Master masterStatus
+	// RetentionHours is unset when RDS purges binlogs as soon as it can
+	RetentionHours sql.NullInt64
+}
+
+func (b binlogInfo) Enabled() bool {
+	return b.Format != "" && !strings.EqualFold(b.Format, "OFF")
+}
+
+func (b binlogInfo) Size() (size int64) {
+	for _, v := range b.Files {
+		size += v.FileSize
+	}
+	return size
+}
+
+type binlogCheck struct{ h handler }
+
+func (binlogCheck) ID() string { return "binlog" }
+func (binlogCheck) Description() string {
+	return "binary logs are enabled and retained long enough"
+}
+func (binlogCheck) Severity() Severity { return SeverityWarning }
+
+func (c binlogCheck) Run(ctx context.Context) (findings []Finding, err error) {
+	min := c.h.policy.MinBinlogRetentionHours
+	info, err := c.h.binlog()
+	if err != nil {
+		return nil, err
+	}
+	if !info.Enabled() {
+		if min > 0 {
+			findings = append(findings, newFinding(c, "binlog_format", "binary logging is disabled"))
+		}
+		return findings, nil
+	}
+	if !info.RetentionHours.Valid {
+		findings = append(findings, newFinding(c, "binlog retention hours", "binlog retention hours is NULL, binlogs are purged as soon as possible"))
+	} else if info.RetentionHours.Int64 < min {
+		findings = append(findings, newFinding(c, "binlog retention hours", "binlogs are retained for %d hours, policy requires %d", info.RetentionHours.Int64, min))
+	}
+	return findings, nil
+}
+
+// binlog reads binlog_format from the parameter groups and asks the server
+// which binary logs it holds and how long it keeps them
+func (h handler) binlog() (info binlogInfo, err error) {
+	err = h.probe("binlog", &info, func() error {
+		info.Format = h.lookup("binlog_format")
+		if !info.Enabled() {
+			return nil
+		}
+
+		err = h.db.Unsafe().Select(&info.Files, "SHOW BINARY LOGS")
+		if err != nil {
+			return fmt.Errorf("failed to show binary logs: %w", err)
+		}
+		err = h.db.Unsafe().Get(&info.Master, "SHOW MASTER STATUS")
+		if err != nil {
+			return fmt.Errorf("failed to show master status: %w", err)
+		}
+
+		var config []rdsConfiguration
+		err = h.db.Unsafe().Select(&config, "CALL mysql.rds_show_configuration")
+		if err != nil {
+			return fmt.Errorf("failed to show rds configuration: %w", err)
+		}
+		for _, v := range config {
+			if v.Name == "binlog retention hours" && v.Value.Valid {
+				hours, err := strconv.ParseInt(v.Value.String, 10, 64)
+				if err != nil {
+					return fmt.Errorf("failed to parse binlog retention hours %q: %w", v.Value.String, err)
+				}
+				info.RetentionHours = sql.NullInt64{Int64: hours, Valid: true}
+			}
+		}
+		return nil
+	})
+	return info, err
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/apex/log"
+)
+
+// Severity ranks how bad a Finding is
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityCritical
+)
+
+var severityNames = []string{"info", "warning", "critical"}
+
+func (s Severity) String() string {
+	if s < 0 || int(s) >= len(severityNames) {
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+	return severityNames[s]
+}
+
+// MarshalText lets findings serialise with a readable severity
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText is the inverse of MarshalText
+func (s *Severity) UnmarshalText(text []byte) (err error) {
+	*s, err = parseSeverity(string(text))
+	return err
+}
+
+func parseSeverity(name string) (Severity, error) {
+	for i, v := range severityNames {
+		if strings.EqualFold(name, v) {
+			return Severity(i), nil
+		}
+	}
+	return SeverityInfo, fmt.Errorf("unknown severity %q", name)
+}
+
+// Finding is a single structured result of a Check, Kind tells apart the
+// findings a check raises about the same subject
+type Finding struct {
+	Account  string   `json:"account"`
+	Cluster  string   `json:"cluster"`
+	Check    string   `json:"check"`
+	Severity Severity `json:"severity"`
+	Subject  string   `json:"subject,omitempty"`
+	Kind     string   `json:"kind,omitempty"`
+	Message  string   `json:"message"`
+}
+
+// Check is a single lint run against the cluster
+type Check interface {
+	ID() string
+	Description() string
+	// Severity is the default severity of findings raised by the check
+	Severity() Severity
+	Run(ctx context.Context) ([]Finding, error)
+}
+
+// checkFactory binds a Check to the handler it inspects
+type checkFactory func(h handler) Check
+
+var registry []checkFactory
+
+// register makes a check available to the HTTP server, metrics and CLI
+func register(f checkFactory) {
+	registry = append(registry, f)
+}
+
+// Checks returns every registered check bound to h, ordered by ID
+func (h handler) Checks() (checks []Check) {
+	for _, f := range registry {
+		c := f(h)
+		if h.policy.disabled(c.ID()) {
+			continue
+		}
+		checks = append(checks, c)
+	}
+	sort.Slice(checks, func(i, j int) bool {
+		return checks[i].ID() < checks[j].ID()
+	})
+	return checks
+}
+
+// kindFailed marks the finding reporting that a check failed to run
+const kindFailed = "failed"
+
+// runChecks evaluates every registered check, a check that fails to run is
+// itself reported as a critical finding
+func (h handler) runChecks(ctx context.Context) (findings []Finding) {
+	for _, c := range h.Checks() {
+		ff, err := c.Run(ctx)
+		if err != nil {
+			log.WithError(err).WithField("check", c.ID()).Error("check failed to run")
+			ff = append(ff, Finding{
+				Check:    c.ID(),
+				Severity: SeverityCritical,
+				Kind:     kindFailed,
+				Message:  fmt.Sprintf("check failed to run: %s", err),
+			})
+		}
+		findings = append(findings, ff...)
+	}
+	findings = h.label(findings)
+	h.recordHistory(findings)
+	return findings
+}
+
+// label stamps findings with the account and cluster they were raised against
+// and applies the policy's severity overrides
+func (h handler) label(findings []Finding) []Finding {
+	for i := range findings {
+		findings[i].Account = h.AccountID
+		findings[i].Cluster = h.Cluster
+		if s, ok := h.policy.Severities[findings[i].Check]; ok {
+			findings[i].Severity = s
+		}
+	}
+	return findings
+}
+
+// withKind sets the finding's Kind, needed when the check may raise another
+// finding about the same subject
+func (f Finding) withKind(kind string) Finding {
+	f.Kind = kind
+	return f
+}
+
+// newFinding raises a finding at the check's default severity
+func newFinding(c Check, subject, format string, args ...interface{}) Finding {
+	return Finding{
+		Check:    c.ID(),
+		Severity: c.Severity(),
+		Subject:  subject,
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
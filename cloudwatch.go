@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"strings"
+)
+
+func init() {
+	register(func(h handler) Check { return cloudwatchCheck{h} })
+}
+
+// logTypes are the Aurora MySQL logs that can be exported to CloudWatch
+var logTypes = []string{"audit", "error", "general", "slowquery"}
+
+// logParameters maps an exported log type to the parameter that enables it
+var logParameters = map[string]string{
+	"audit":     "server_audit_logging",
+	"general":   "general_log",
+	"slowquery": "slow_query_log",
+}
+
+// defaultLogOutput is where Aurora MySQL writes logs while log_output is left
+// at its engine default, which describeCluster doesn't fetch
+const defaultLogOutput = "FILE"
+
+// logOutput is the effective log_output of the cluster
+func (h handler) logOutput() string {
+	if v := h.lookup("log_output"); v != "" {
+		return v
+	}
+	return defaultLogOutput
+}
+
+type cloudwatchCheck struct{ h handler }
+
+func (cloudwatchCheck) ID() string { return "cloudwatch" }
+func (cloudwatchCheck) Description() string {
+	return "required logs are exported to CloudWatch and enabled logs are shipped"
+}
+func (cloudwatchCheck) Severity() Severity { return SeverityWarning }
+
+func (c cloudwatchCheck) Run(ctx context.Context) (findings []Finding, err error) {
+	h := c.h
+	for _, logType := range h.policy.RequiredLogExports {
+		if !h.exportsLog(logType) {
+			findings = append(findings, newFinding(c, logType, "%s log is not exported to CloudWatch", logType).withKind("required"))
+		}
+	}
+
+	// only logs written to files are picked up by the export
+	output := h.logOutput()
+	fileOutput := strings.Contains(strings.ToUpper(output), "FILE")
+	for _, logType := range logTypes {
+		param, ok := logParameters[logType]
+		if !ok {
+			continue
+		}
+		enabled := h.lookup(param) == "1"
+		exported := h.exportsLog(logType)
+		switch {
+		case enabled && !exported:
+			findings = append(findings, newFinding(c, logType, "%s is enabled but the %s log is never shipped to CloudWatch", param, logType).withKind("shipping"))
+		case exported && !enabled:
+			findings = append(findings, newFinding(c, logType, "%s log is exported but %s is not enabled", logType, param).withKind("shipping"))
+		case exported && logType != "audit" && !fileOutput:
+			findings = append(findings, newFinding(c, logType, "%s log is exported but log_output %q does not write to FILE", logType, output).withKind("shipping"))
+		}
+	}
+	return findings, nil
+}
+
+func (h handler) exportsLog(logType string) bool {
+	for _, v := range h.dbInfo.get().Cluster.EnabledCloudwatchLogsExports {
+		if v == logType {
+			return true
+		}
+	}
+	return false
+}
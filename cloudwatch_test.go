@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+)
+
+func TestCloudwatchLogOutput(t *testing.T) {
+	tests := []struct {
+		name      string
+		logOutput string
+		want      []string
+	}{
+		{name: "engine default", want: nil},
+		{name: "file", logOutput: "FILE", want: nil},
+		{name: "table and file", logOutput: "TABLE,FILE", want: nil},
+		{name: "table", logOutput: "TABLE", want: []string{`slowquery log is exported but log_output "TABLE" does not write to FILE`}},
+	}
+	for _, tt := range tests {
+		params := []rds.Parameter{{ParameterName: aws.String("slow_query_log"), ParameterValue: aws.String("1")}}
+		if tt.logOutput != "" {
+			params = append(params, rds.Parameter{ParameterName: aws.String("log_output"), ParameterValue: aws.String(tt.logOutput)})
+		}
+		h := handler{dbInfo: &latestInfo{info: dbinfo{
+			Cluster: rds.DBCluster{EnabledCloudwatchLogsExports: []string{"slowquery"}},
+			Params:  params,
+		}}}
+		findings, err := cloudwatchCheck{h}.Run(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, f := range findings {
+			got = append(got, f.Message)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
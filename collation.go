@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func init() {
+	register(func(h handler) Check { return unicodeCheck{h} })
+}
+
+type tableStatus struct {
+	Name          string         `db:"Name"`
+	Engine        sql.NullString `db:"Engine"`
+	Version       sql.NullString `db:"Version"`
+	RowFormat     sql.NullString `db:"Row_format"`
+	Rows          sql.NullString `db:"Rows"`
+	AvgRowLength  sql.NullString `db:"Avg_row_length"`
+	DataLength    sql.NullString `db:"Data_length"`
+	MaxDataLength sql.NullString `db:"Max_data_length"`
+	IndexLength   sql.NullString `db:"Index_length"`
+	DataFree      sql.NullString `db:"Data_free"`
+	AutoIncrement sql.NullInt64  `db:"Auto_increment"`
+	CreateTime    mysql.NullTime `db:"Create_time"`
+	UpdateTime    mysql.NullTime `db:"Update_time"`
+	CheckTime     mysql.NullTime `db:"Check_time"`
+	Checksum      sql.NullString `db:"Checksum"`
+	CreateOptions sql.NullString `db:"Create_options"`
+	Comment       sql.NullString `db:"Comment"`
+	Collation     sql.NullString `db:"Collation"`
+}
+
+type showCreate struct {
+	Database       string `db:"Database"`
+	CreateDatabase string `db:"Create Database"`
+}
+
+type dbunicode struct {
+	Name   string
+	Info   []showCreate
+	Tables []tableStatus
+}
+
+type unicodeCheck struct{ h handler }
+
+func (unicodeCheck) ID() string          { return "unicode" }
+func (unicodeCheck) Description() string { return "tables have the policy collation" }
+func (unicodeCheck) Severity() Severity  { return SeverityWarning }
+
+func (c unicodeCheck) Run(ctx context.Context) ([]Finding, error) {
+	dbs, err := c.h.databaseCollations()
+	if err != nil {
+		return nil, err
+	}
+	return c.findings(dbs), nil
+}
+
+func (c unicodeCheck) findings(dbs []dbunicode) (findings []Finding) {
+	for _, db := range dbs {
+		for _, t := range db.Tables {
+			subject := db.Name + "." + t.Name
+			if !t.Collation.Valid {
+				findings = append(findings, newFinding(c, subject, "Missing collation"))
+				continue
+			}
+			if t.Collation.String != c.h.policy.Collation {
+				findings = append(findings, newFinding(c, subject, "Collation %s", t.Collation.String))
+			}
+		}
+	}
+	return findings
+}
+
+// quoteIdent quotes a schema or table name for MySQL
+func quoteIdent(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+// quoteString quotes a string literal such as a sql_mode for MySQL
+func quoteString(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// databaseCollations describes the policy schemas and their tables
+func (h handler) databaseCollations() (dbinfo []dbunicode, err error) {
+	err = h.probe("collations", &dbinfo, func() error {
+		for _, name := range h.policy.Schemas {
+			dbinfo = append(dbinfo, dbunicode{Name: name})
+		}
+
+		// USE would change the default schema of whichever pooled connection
+		// ran it, so every statement names its schema instead
+		for j := 0; j < len(dbinfo); j++ {
+			err := h.db.Select(&dbinfo[j].Info, fmt.Sprintf("SHOW CREATE DATABASE %s", quoteIdent(dbinfo[j].Name)))
+			if err != nil {
+				return fmt.Errorf("failed to show database %s: %w", dbinfo[j].Name, err)
+			}
+
+			err = h.db.Select(&dbinfo[j].Tables, fmt.Sprintf("SHOW TABLE STATUS FROM %s", quoteIdent(dbinfo[j].Name)))
+			if err != nil {
+				return fmt.Errorf("failed to show tables of %s: %w", dbinfo[j].Name, err)
+			}
+		}
+		return nil
+	})
+	return dbinfo, err
+}
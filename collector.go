@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// defaultCacheTTL bounds how often a scrape hits AWS and the database
+const defaultCacheTTL = time.Minute
+
+// defaultRefreshTimeout stays below Prometheus' default 10s scrape timeout
+const defaultRefreshTimeout = 8 * time.Second
+
+// collector re-describes the cluster and re-runs the checks when scraped,
+// reusing the previous evaluation until ttl has passed. A scrape waits at most
+// timeout for an evaluation, then serves the previous one
+type collector struct {
+	h       handler
+	ttl     time.Duration
+	timeout time.Duration
+
+	descs map[string]*prometheus.Desc
+
+	mu      sync.Mutex
+	updated time.Time
+	metrics []prometheus.Metric
+	// refreshing is closed when the evaluation in flight finishes
+	refreshing chan struct{}
+}
+
+// envDuration reads a duration from the environment, def when unset or invalid
+func envDuration(name string, def time.Duration) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.WithError(err).Warnf("ignoring %s %q", name, v)
+		return def
+	}
+	return d
+}
+
+func newCollector(h handler) *collector {
+	c := &collector{
+		h:       h,
+		ttl:     envDuration("METRICS_CACHE_TTL", defaultCacheTTL),
+		timeout: envDuration("METRICS_TIMEOUT", defaultRefreshTimeout),
+		descs:   map[string]*prometheus.Desc{},
+	}
+	c.describe("dbinfo",
+		"A metric with a constant '1' value labeled by the Unee-T schema version, Aurora version and lambda commit.",
+		"schemaversion",
+		"auroraversion",
+		"commit",
+		"engineversion",
+		"instanceclass",
+		"endpoint",
+		"innodb_file_format",
+		"status")
+	c.describe("slowlog",
+		"A metric with a constant '1' value labeled with slow log lint.",
+		"enabled",
+		"log_output",
+		"log_queries_not_using_indexes")
+	c.describe("generallog",
+		"A metric with a constant '1' value labeled with general log lint.",
+		"enabled",
+		"log_output")
+	c.describe("iam", "shows whether IAM auth is enabled or not.")
+	c.describe("row_count", "shows the last sampled number of rows of a watchlist table.", "table")
+	c.describe("row_count_drop", "shows the fraction of rows a watchlist table lost since the peak of its recent samples.", "table")
+	c.describe("triggers", "shows the number of triggers in each schema.", "schema")
+	c.describe("auto_increment_headroom", "shows the fraction of an auto_increment key's range that is still free.", "schema", "table", "column", "column_type")
+	c.describe("uptime_seconds", "shows the Uptime global status of each cluster member.", "instance")
+	c.describe("insync", "shows whether we are in-sync with the parameter groups")
+	c.describe("findings", "shows the number of lint findings labeled by check and severity.", "check", "severity")
+	c.describe("backup_retention_days", "shows how many days of automated backups are retained.")
+	c.describe("backup_window", "A metric with a constant '1' value labeled with the backup and maintenance windows.", "backup_window", "maintenance_window")
+	c.describe("backtrack_window_seconds", "shows how far back the cluster can be backtracked, 0 when disabled.")
+	c.describe("backtrack_consumed_change_records", "shows the number of change records stored for backtrack.")
+	c.describe("backtracks", "shows the number of backtracks labeled by status.", "status")
+	c.describe("cloudwatch_logs_exported", "shows whether a log type is exported to CloudWatch.", "log_type")
+	c.describe("binlog", "A metric with a constant '1' value labeled with the binlog format and current file.", "binlog_format", "file")
+	c.describe("binlog_retention_hours", "shows how many hours of binary logs are kept, how far back binlogs go.")
+	c.describe("binlog_files", "shows the number of binary logs on the server.")
+	c.describe("binlog_size_bytes", "shows the total size of binary logs on the server.")
+	c.describe("lambda_roundtrips_total", "counts lambda_async round trips by result.", "result")
+	c.describe("lambda_roundtrip_latency_seconds", "shows how long the last acknowledged lambda_async round trip took.")
+	return c
+}
+
+// describe adds a gauge, every metric is labeled with the target so
+// collectors for several clusters can share a registry
+func (c *collector) describe(name, help string, labels ...string) {
+	c.descs[name] = prometheus.NewDesc(name, help, labels,
+		prometheus.Labels{"account": c.h.AccountID, "cluster": c.h.Cluster})
+}
+
+func (c *collector) gauge(name string, value float64, labels ...string) prometheus.Metric {
+	return prometheus.MustNewConstMetric(c.descs[name], prometheus.GaugeValue, value, labels...)
+}
+
+func (c *collector) counter(name string, value float64, labels ...string) prometheus.Metric {
+	return prometheus.MustNewConstMetric(c.descs[name], prometheus.CounterValue, value, labels...)
+}
+
+func (c *collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range c.descs {
+		ch <- d
+	}
+}
+
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	if c.refreshing == nil && (c.metrics == nil || time.Since(c.updated) > c.ttl) {
+		c.refreshing = make(chan struct{})
+		go c.refresh()
+	}
+	refreshing := c.refreshing
+	c.mu.Unlock()
+
+	if refreshing != nil {
+		select {
+		case <-refreshing:
+		case <-time.After(c.timeout):
+			log.WithField("cluster", c.h.Cluster).Warnf("evaluation is taking over %s, serving the previous one", c.timeout)
+		}
+	}
+
+	c.mu.Lock()
+	metrics := c.metrics
+	c.mu.Unlock()
+	for _, m := range metrics {
+		ch <- m
+	}
+}
+
+// refresh runs one evaluation in the background, bounded by the collector's
+// timeout, so a hung AWS or database call never holds up a scrape
+func (c *collector) refresh() {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	metrics, err := c.evaluate(ctx)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		log.WithError(err).Error("failed to refresh cluster description")
+	} else {
+		c.metrics = metrics
+		c.updated = time.Now()
+	}
+	close(c.refreshing)
+	c.refreshing = nil
+}
+
+// evaluate re-evaluates every metric, failing if the cluster cannot be
+// described so the last good evaluation is kept
+func (c *collector) evaluate(ctx context.Context) (metrics []prometheus.Metric, err error) {
+	dbInfo, err := c.h.describeCluster(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.h.dbInfo.set(dbInfo)
+	h := c.h
+
+	metrics = []prometheus.Metric{
+		c.gauge("dbinfo", 1,
+			h.schemaversion(),
+			h.aversion(),
+			commit,
+			h.engineVersion(),
+			h.instanceClass(),
+			*dbInfo.Cluster.Endpoint,
+			h.innodbFileFormat(),
+			// https://docs.aws.amazon.com/AmazonRDS/latest/UserGuide/Overview.DBInstance.Status.html
+			*dbInfo.Cluster.Status),
+		c.gauge("slowlog", 1,
+			h.lookup("slow_query_log"),
+			h.lookup("log_output"),
+			h.lookup("log_queries_not_using_indexes")),
+		c.gauge("generallog", 1,
+			h.lookup("general_log"),
+			h.lookup("log_output")),
+		c.gauge("backup_retention_days", float64(aws.Int64Value(dbInfo.Cluster.BackupRetentionPeriod))),
+		c.gauge("backup_window", 1,
+			aws.StringValue(dbInfo.Cluster.PreferredBackupWindow),
+			aws.StringValue(dbInfo.Cluster.PreferredMaintenanceWindow)),
+	}
+
+	metrics = append(metrics,
+		c.gauge("backtrack_window_seconds", float64(aws.Int64Value(dbInfo.Cluster.BacktrackWindow))),
+		c.gauge("backtrack_consumed_change_records", float64(aws.Int64Value(dbInfo.Cluster.BacktrackConsumedChangeRecords))),
+	)
+	if aws.Int64Value(dbInfo.Cluster.BacktrackWindow) > 0 {
+		backtracks, err := h.backtracks(ctx)
+		if err != nil {
+			log.WithError(err).Error("failed to list backtracks")
+		}
+		statuses := map[string]int{}
+		for _, v := range backtracks {
+			statuses[aws.StringValue(v.Status)]++
+		}
+		for status, n := range statuses {
+			metrics = append(metrics, c.gauge("backtracks", float64(n), status))
+		}
+	}
+
+	for _, logType := range logTypes {
+		var exported float64
+		if h.exportsLog(logType) {
+			exported = 1
+		}
+		metrics = append(metrics, c.gauge("cloudwatch_logs_exported", exported, logType))
+	}
+
+	binlog, err := h.binlog()
+	if err != nil {
+		log.WithError(err).Error("failed to inspect binlogs")
+	}
+	metrics = append(metrics, c.gauge("binlog", 1, binlog.Format, binlog.Master.File))
+	if binlog.Enabled() && err == nil {
+		metrics = append(metrics,
+			c.gauge("binlog_retention_hours", float64(binlog.RetentionHours.Int64)),
+			c.gauge("binlog_files", float64(len(binlog.Files))),
+			c.gauge("binlog_size_bytes", float64(binlog.Size())),
+		)
+	}
+
+	uptimes, err := h.instanceUptimes()
+	if err != nil {
+		log.WithError(err).Error("failed to get uptimes")
+	}
+	for instance, uptime := range uptimes {
+		metrics = append(metrics, c.gauge("uptime_seconds", uptime.Seconds(), instance))
+	}
+
+	keys, err := h.autoIncrements()
+	if err != nil {
+		log.WithError(err).Error("failed to get auto_increment headroom")
+	}
+	for _, v := range keys {
+		if v.Max > 0 {
+			metrics = append(metrics, c.gauge("auto_increment_headroom", 1-v.Used, v.Schema, v.Table, v.Column, v.ColumnType))
+		}
+	}
+
+	triggers, err := h.triggers()
+	if err != nil {
+		log.WithError(err).Error("failed to list triggers")
+	}
+	triggerCounts := map[string]int{}
+	for _, schema := range h.policy.Schemas {
+		triggerCounts[schema] = 0
+	}
+	for _, t := range triggers {
+		triggerCounts[t.Schema]++
+	}
+	for schema, n := range triggerCounts {
+		metrics = append(metrics, c.gauge("triggers", float64(n), schema))
+	}
+
+	for _, table := range h.policy.Watchlist {
+		if current, ok := h.rowCounts.last(table); ok {
+			metrics = append(metrics, c.gauge("row_count", float64(current.Rows), table))
+		}
+		if drop, _, _, ok := h.rowDrop(table); ok {
+			metrics = append(metrics, c.gauge("row_count_drop", drop, table))
+		}
+	}
+
+	if h.policy.AckURL != "" {
+		l, err := h.roundTrips(ctx)
+		if err != nil {
+			log.WithError(err).Error("failed to get round trips")
+		}
+		metrics = append(metrics,
+			c.counter("lambda_roundtrips_total", float64(l.Acked), "acknowledged"),
+			c.counter("lambda_roundtrips_total", float64(l.Failed), "failed"))
+		if last, ok := l.last(); ok && last.Acked != nil {
+			metrics = append(metrics, c.gauge("lambda_roundtrip_latency_seconds", last.Latency))
+		}
+	}
+
+	var iamEnabled float64
+	for _, db := range dbInfo.DBs {
+		if *db.IAMDatabaseAuthenticationEnabled {
+			iamEnabled = 1
+		}
+	}
+	metrics = append(metrics, c.gauge("iam", iamEnabled))
+
+	findings := h.runChecks(ctx)
+	counts := map[string]map[Severity]int{}
+	for _, check := range h.Checks() {
+		counts[check.ID()] = map[Severity]int{check.Severity(): 0}
+	}
+	for _, f := range findings {
+		if counts[f.Check] == nil {
+			counts[f.Check] = map[Severity]int{}
+		}
+		counts[f.Check][f.Severity]++
+	}
+	var insync float64 = 1
+	for id, severities := range counts {
+		for severity, n := range severities {
+			metrics = append(metrics, c.gauge("findings", float64(n), id, severity.String()))
+			if id == (insyncCheck{}).ID() && n > 0 {
+				insync = 0
+			}
+		}
+	}
+	metrics = append(metrics, c.gauge("insync", insync))
+	return metrics, nil
+}
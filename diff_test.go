@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	lines := func(s string) []string {
+		if s == "" {
+			return nil
+		}
+		return strings.Split(s, " ")
+	}
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{
+			name: "empty diff",
+			a:    "a b c",
+			b:    "a b c",
+			want: "",
+		},
+		{
+			name: "both empty",
+			want: "",
+		},
+		{
+			name: "changed line",
+			a:    "a b c",
+			b:    "a x c",
+			want: "--- ref\n+++ live\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n",
+		},
+		{
+			name: "added to empty",
+			b:    "a b",
+			want: "--- ref\n+++ live\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name: "removed everything",
+			a:    "a b",
+			want: "--- ref\n+++ live\n@@ -1,2 +0,0 @@\n-a\n-b\n",
+		},
+		{
+			name: "context is trimmed to three lines",
+			a:    "1 2 3 4 5 6 7 8 9",
+			b:    "1 2 3 4 5 6 7 8 9 10",
+			want: "--- ref\n+++ live\n@@ -7,3 +7,4 @@\n 7\n 8\n 9\n+10\n",
+		},
+		{
+			name: "distant changes make separate hunks",
+			a:    "1 2 3 4 5 6 7 8 9 10 11 12",
+			b:    "x 2 3 4 5 6 7 8 9 10 11 y",
+			want: "--- ref\n+++ live\n@@ -1,4 +1,4 @@\n-1\n+x\n 2\n 3\n 4\n@@ -9,4 +9,4 @@\n 9\n 10\n 11\n-12\n+y\n",
+		},
+		{
+			name: "seven unchanged lines part hunks",
+			a:    "1 2 3 4 5 6 7 8 9",
+			b:    "x 2 3 4 5 6 7 8 y",
+			want: "--- ref\n+++ live\n@@ -1,4 +1,4 @@\n-1\n+x\n 2\n 3\n 4\n@@ -6,4 +6,4 @@\n 6\n 7\n 8\n-9\n+y\n",
+		},
+		{
+			name: "six unchanged lines share a hunk",
+			a:    "1 2 3 4 5 6 7 8",
+			b:    "x 2 3 4 5 6 7 y",
+			want: "--- ref\n+++ live\n@@ -1,8 +1,8 @@\n-1\n+x\n 2\n 3\n 4\n 5\n 6\n 7\n-8\n+y\n",
+		},
+	}
+	for _, tt := range tests {
+		if got := unifiedDiff("ref", "live", lines(tt.a), lines(tt.b)); got != tt.want {
+			t.Errorf("%s:\n got %q\nwant %q", tt.name, got, tt.want)
+		}
+	}
+}
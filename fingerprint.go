@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/tj/go/http/response"
+)
+
+func init() {
+	register(func(h handler) Check { return procedureDriftCheck{h} })
+}
+
+var (
+	definerExp   = regexp.MustCompile("DEFINER=`[^`]*`@`[^`]*`\\s*")
+	lambdaArnExp = regexp.MustCompile(`arn:aws[\w-]*:lambda:[\w-]+:\d{12}:`)
+	blankLines   = regexp.MustCompile(`\n{2,}`)
+)
+
+// procedureFingerprint identifies a routine body independent of the
+// environment it was created in
+type procedureFingerprint struct {
+	SHA256 string `json:"sha256"`
+	Source string `json:"source"`
+}
+
+// fingerprints are keyed by database.procedure
+type fingerprints map[string]procedureFingerprint
+
+// normalizeRoutine strips what legitimately differs between environments, the
+// definer, account and region of lambda ARNs, and insignificant whitespace
+func normalizeRoutine(src string) string {
+	src = strings.Replace(src, "\r\n", "\n", -1)
+	src = definerExp.ReplaceAllString(src, "")
+	src = lambdaArnExp.ReplaceAllString(src, "arn:aws:lambda:REGION:ACCOUNT:")
+	lines := strings.Split(src, "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRight(l, " \t")
+	}
+	src = blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n")
+	return strings.TrimSpace(src) + "\n"
+}
+
+func fingerprint(src string) procedureFingerprint {
+	normalized := normalizeRoutine(src)
+	sum := sha256.Sum256([]byte(normalized))
+	return procedureFingerprint{SHA256: hex.EncodeToString(sum[:]), Source: normalized}
+}
+
+// liveFingerprints fingerprints every user defined procedure
+func (h handler) liveFingerprints() (fingerprints, error) {
+	procs, err := h.procedures()
+	if err != nil {
+		return nil, err
+	}
+	live := fingerprints{}
+	for _, v := range procs {
+		live[v.Database+"."+v.Procedure] = fingerprint(v.Source.String)
+	}
+	return live, nil
+}
+
+// referenceFingerprints loads the fingerprints captured from the reference
+// environment, nil when the policy names none
+func (h handler) referenceFingerprints() (reference fingerprints, err error) {
+	if h.policy.ProcedureReference == "" {
+		return nil, nil
+	}
+	err = h.probe("procedure_reference", &reference, func() error {
+		f, err := os.Open(h.policy.ProcedureReference)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		err = json.NewDecoder(f).Decode(&reference)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", h.policy.ProcedureReference, err)
+		}
+		return nil
+	})
+	return reference, err
+}
+
+type procedureDriftCheck struct{ h handler }
+
+func (procedureDriftCheck) ID() string { return "procedure_drift" }
+func (procedureDriftCheck) Description() string {
+	return "stored procedures match the reference environment and have not changed recently"
+}
+func (procedureDriftCheck) Severity() Severity { return SeverityWarning }
+
+func (c procedureDriftCheck) Run(ctx context.Context) (findings []Finding, err error) {
+	live, err := c.h.liveFingerprints()
+	if err != nil {
+		return nil, err
+	}
+	reference, err := c.h.referenceFingerprints()
+	if err != nil {
+		return nil, err
+	}
+
+	if reference != nil {
+		for _, name := range unionKeys(reference, live) {
+			want, wok := reference[name]
+			got, gok := live[name]
+			switch {
+			case !gok:
+				findings = append(findings, newFinding(c, name, "missing, present in reference").withKind("reference"))
+			case !wok:
+				findings = append(findings, newFinding(c, name, "not in reference, sha256 %s", got.SHA256).withKind("reference"))
+			case want.SHA256 != got.SHA256:
+				findings = append(findings, newFinding(c, name, "differs from reference, sha256 %s != %s", got.SHA256, want.SHA256).withKind("reference"))
+			}
+		}
+	}
+
+	// the history remembers each fingerprint across evaluations and restarts,
+	// so every evaluator sees a change for the whole window
+	if c.h.history != nil {
+		now := time.Now()
+		for name, got := range live {
+			was, at, ok := c.h.history.changed(c.h.AccountID, c.h.Cluster, "procedure/"+name, got.SHA256,
+				time.Duration(c.h.policy.ProcedureChangeWindow), now)
+			if !ok {
+				continue
+			}
+			f := newFinding(c, name, "changed at %s, sha256 %s was %s", at.Format(time.RFC3339), got.SHA256, was).withKind("changed")
+			f.Severity = SeverityInfo
+			findings = append(findings, f)
+		}
+	}
+	sort.Slice(findings, func(i, j int) bool { return findings[i].Subject < findings[j].Subject })
+	return findings, nil
+}
+
+type procedureStatus struct {
+	Name      string `json:"name"`
+	SHA256    string `json:"sha256"`
+	Reference string `json:"reference,omitempty"`
+	Matches   bool   `json:"matches"`
+}
+
+// procedureFingerprints lists each live procedure's fingerprint and whether it
+// matches the reference, ?name=database.procedure shows a unified diff
+func (h handler) procedureFingerprints(w http.ResponseWriter, r *http.Request) {
+	live, err := h.liveFingerprints()
+	if err != nil {
+		log.WithError(err).Error("failed to fingerprint procedures")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	reference, err := h.referenceFingerprints()
+	if err != nil {
+		log.WithError(err).Error("failed to load reference fingerprints")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if name := r.URL.Query().Get("name"); name != "" {
+		got, gok := live[name]
+		want, wok := reference[name]
+		if !gok && !wok {
+			http.Error(w, fmt.Sprintf("unknown procedure %q", name), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprint(w, unifiedDiff("reference/"+name, h.Name+"/"+name, splitLines(want.Source), splitLines(got.Source)))
+		return
+	}
+
+	statuses := []procedureStatus{}
+	for _, name := range unionKeys(reference, live) {
+		got, want := live[name], reference[name]
+		statuses = append(statuses, procedureStatus{
+			Name:      name,
+			SHA256:    got.SHA256,
+			Reference: want.SHA256,
+			Matches:   got.SHA256 == want.SHA256,
+		})
+	}
+	response.JSON(w, statuses)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// dumpFingerprints writes the procedures of the first target as a reference
+func dumpFingerprints(args []string) int {
+	f, err := newFleet()
+	if err != nil {
+		log.WithError(err).Error("error setting configuration")
+		return 2
+	}
+	defer f.Close()
+
+	live, err := f[0].liveFingerprints()
+	if err != nil {
+		log.WithError(err).Error("failed to fingerprint procedures")
+		return 1
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(live)
+	if err != nil {
+		log.WithError(err).Error("failed to write fingerprints")
+		return 1
+	}
+	return 0
+}
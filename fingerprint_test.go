@@ -0,0 +1,47 @@
+package main
+
+import "testing"
+
+func TestNormalizeRoutine(t *testing.T) {
+	tests := []struct {
+		name, src, want string
+	}{
+		{
+			name: "definer",
+			src:  "CREATE DEFINER=`root`@`%` PROCEDURE `p`()\nBEGIN\nEND",
+			want: "CREATE PROCEDURE `p`()\nBEGIN\nEND\n",
+		},
+		{
+			name: "lambda ARN account and region",
+			src:  "CALL mysql.lambda_async('arn:aws:lambda:ap-southeast-1:812644853088:function:alambda_simple', '{}')",
+			want: "CALL mysql.lambda_async('arn:aws:lambda:REGION:ACCOUNT:function:alambda_simple', '{}')\n",
+		},
+		{
+			name: "line endings, trailing and blank lines",
+			src:  "\r\nBEGIN  \r\n\r\n\r\n\tSELECT 1;\t\r\nEND\r\n\r\n",
+			want: "BEGIN\n\tSELECT 1;\nEND\n",
+		},
+		{
+			name: "indentation is kept",
+			src:  "BEGIN\n    SELECT 1;\nEND",
+			want: "BEGIN\n    SELECT 1;\nEND\n",
+		},
+	}
+	for _, tt := range tests {
+		if got := normalizeRoutine(tt.src); got != tt.want {
+			t.Errorf("%s: normalizeRoutine = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFingerprintAcrossEnvironments(t *testing.T) {
+	dev := fingerprint("CREATE DEFINER=`root`@`%` PROCEDURE `p`()\nBEGIN\n  CALL mysql.lambda_async('arn:aws:lambda:ap-southeast-1:812644853088:function:f', '{}');\nEND")
+	prod := fingerprint("CREATE DEFINER=`admin`@`10.0.%` PROCEDURE `p`()\r\nBEGIN\r\n  CALL mysql.lambda_async('arn:aws:lambda:us-west-2:192458993663:function:f', '{}');  \r\nEND\r\n")
+	if dev != prod {
+		t.Errorf("fingerprints differ:\n%s\n%s", dev.Source, prod.Source)
+	}
+	changed := fingerprint("CREATE PROCEDURE `p`()\nBEGIN\n  CALL mysql.lambda_async('arn:aws:lambda:ap-southeast-1:812644853088:function:g', '{}');\nEND")
+	if changed.SHA256 == dev.SHA256 {
+		t.Error("a different function has the same fingerprint")
+	}
+}
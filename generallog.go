@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"strings"
+)
+
+func init() {
+	register(func(h handler) Check { return generalLogCheck{h} })
+}
+
+type generalLogCheck struct{ h handler }
+
+func (generalLogCheck) ID() string { return "generallog" }
+func (generalLogCheck) Description() string {
+	return "general log is off unless the policy allows it and never grows a table unbounded"
+}
+func (generalLogCheck) Severity() Severity { return SeverityWarning }
+
+func (c generalLogCheck) Run(ctx context.Context) (findings []Finding, err error) {
+	if c.h.lookup("general_log") != "1" {
+		return nil, nil
+	}
+	if !c.h.policy.AllowGeneralLog {
+		findings = append(findings, newFinding(c, "general_log", "general_log is enabled, it slows every query and records PII"))
+	}
+	if output := c.h.logOutput(); strings.Contains(strings.ToUpper(output), "TABLE") {
+		findings = append(findings, newFinding(c, "log_output", "log_output %q grows mysql.general_log unbounded while general_log is enabled", output))
+	}
+	return findings, nil
+}
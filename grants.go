@@ -0,0 +1,464 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+func init() {
+	register(func(h handler) Check { return grantsCheck{h} })
+}
+
+// account is a MySQL user@host
+type account struct {
+	User string `json:"user" db:"user"`
+	Host string `json:"host" db:"host"`
+}
+
+func (a account) String() string {
+	return fmt.Sprintf("'%s'@'%s'", a.User, a.Host)
+}
+
+// quoted escapes the account for interpolation, SHOW GRANTS takes no placeholders
+func (a account) quoted() string {
+	q := func(s string) string { return strings.Replace(s, "'", "''", -1) }
+	return fmt.Sprintf("'%s'@'%s'", q(a.User), q(a.Host))
+}
+
+// privilege is a privilege name, restricted to Columns when it is a column grant
+type privilege struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns,omitempty"`
+}
+
+// scope is what a grant applies to, Schema and Table are * at the global and
+// schema level, and Schema may hold LIKE wildcards at the schema level
+type scope struct {
+	Object string `json:"object,omitempty"` // TABLE, FUNCTION or PROCEDURE
+	Schema string `json:"schema"`
+	Table  string `json:"table"`
+}
+
+func (s scope) String() string {
+	on := s.Schema + "." + s.Table
+	if s.Object != "" && s.Object != "TABLE" {
+		on = s.Object + " " + on
+	}
+	return on
+}
+
+// grant is one parsed SHOW GRANTS row
+type grant struct {
+	Privileges  []privilege `json:"privileges,omitempty"`
+	On          scope       `json:"on"`
+	Proxied     *account    `json:"proxied,omitempty"`
+	Roles       []account   `json:"roles,omitempty"`
+	Grantee     account     `json:"grantee"`
+	GrantOption bool        `json:"grant_option"`
+	Statement   string      `json:"statement"`
+}
+
+type grantToken struct {
+	quoted bool
+	text   string
+}
+
+// is matches an unquoted keyword or punctuation
+func (t grantToken) is(s string) bool {
+	return !t.quoted && strings.EqualFold(t.text, s)
+}
+
+// lexGrant splits a statement into words, punctuation and quoted names
+func lexGrant(s string) (tokens []grantToken, err error) {
+	r := []rune(s)
+	for i := 0; i < len(r); {
+		c := r[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '`' || c == '\'' || c == '"':
+			var text strings.Builder
+			j := i + 1
+			for ; j < len(r); j++ {
+				if r[j] == '\\' && c != '`' && j+1 < len(r) {
+					j++
+					text.WriteRune(r[j])
+					continue
+				}
+				if r[j] == c {
+					// a doubled quote is a literal quote
+					if j+1 < len(r) && r[j+1] == c {
+						text.WriteRune(c)
+						j++
+						continue
+					}
+					break
+				}
+				text.WriteRune(r[j])
+			}
+			if j >= len(r) {
+				return nil, fmt.Errorf("unterminated %c at %d", c, i)
+			}
+			tokens = append(tokens, grantToken{quoted: true, text: text.String()})
+			i = j + 1
+		case strings.ContainsRune("(),.@*;", c):
+			tokens = append(tokens, grantToken{text: string(c)})
+			i++
+		default:
+			j := i
+			for j < len(r) && !unicode.IsSpace(r[j]) && !strings.ContainsRune("(),.@*;`'\"", r[j]) {
+				j++
+			}
+			tokens = append(tokens, grantToken{text: string(r[i:j])})
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+type grantParser struct {
+	tokens []grantToken
+	pos    int
+}
+
+func (p *grantParser) peek() grantToken {
+	if p.pos >= len(p.tokens) {
+		return grantToken{}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *grantParser) next() grantToken {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *grantParser) done() bool { return p.pos >= len(p.tokens) }
+
+func (p *grantParser) expect(s string) error {
+	if t := p.next(); !t.is(s) {
+		return fmt.Errorf("expected %s, got %q", s, t.text)
+	}
+	return nil
+}
+
+// account parses user@host, an unqualified user is user@%
+func (p *grantParser) account() (a account, err error) {
+	if p.done() {
+		return a, fmt.Errorf("expected account")
+	}
+	a.User, a.Host = p.next().text, "%"
+	if p.peek().is("@") {
+		p.next()
+		if p.done() {
+			return a, fmt.Errorf("expected host of %s", a.User)
+		}
+		a.Host = p.next().text
+	}
+	return a, nil
+}
+
+// scope parses [TABLE|FUNCTION|PROCEDURE] *, *.*, schema.* or schema.table
+func (p *grantParser) scope() (s scope, err error) {
+	if t := p.peek(); t.is("TABLE") || t.is("FUNCTION") || t.is("PROCEDURE") {
+		s.Object = strings.ToUpper(p.next().text)
+	}
+	if p.done() {
+		return s, fmt.Errorf("expected privilege level")
+	}
+	first := p.next().text
+	if !p.peek().is(".") {
+		// unqualified names are relative to the default schema
+		return s, fmt.Errorf("unqualified privilege level %q", first)
+	}
+	p.next()
+	if p.done() {
+		return s, fmt.Errorf("expected table after %s.", first)
+	}
+	s.Schema, s.Table = first, p.next().text
+	return s, nil
+}
+
+// parseGrant parses a SHOW GRANTS row into its privileges, scope, grantee and
+// whether it carries the grant option
+func parseGrant(statement string) (g grant, err error) {
+	g.Statement = statement
+	tokens, err := lexGrant(statement)
+	if err != nil {
+		return g, err
+	}
+	p := &grantParser{tokens: tokens}
+	if err = p.expect("GRANT"); err != nil {
+		return g, err
+	}
+
+	// a grant without ON grants roles
+	hasOn := false
+	for _, t := range tokens {
+		if t.is("ON") {
+			hasOn = true
+			break
+		}
+		if t.is("TO") {
+			break
+		}
+	}
+
+	if hasOn {
+		for {
+			var words []string
+			for !p.done() && !p.peek().is(",") && !p.peek().is("(") && !p.peek().is("ON") {
+				words = append(words, strings.ToUpper(p.next().text))
+			}
+			if len(words) == 0 {
+				return g, fmt.Errorf("expected privilege, got %q", p.peek().text)
+			}
+			priv := privilege{Name: strings.Join(words, " ")}
+			if p.peek().is("(") {
+				p.next()
+				for !p.done() && !p.peek().is(")") {
+					if t := p.next(); !t.is(",") {
+						priv.Columns = append(priv.Columns, t.text)
+					}
+				}
+				if err = p.expect(")"); err != nil {
+					return g, err
+				}
+			}
+			g.Privileges = append(g.Privileges, priv)
+			if !p.peek().is(",") {
+				break
+			}
+			p.next()
+		}
+		if err = p.expect("ON"); err != nil {
+			return g, err
+		}
+		if len(g.Privileges) == 1 && g.Privileges[0].Name == "PROXY" {
+			proxied, err := p.account()
+			if err != nil {
+				return g, err
+			}
+			g.Proxied = &proxied
+		} else if g.On, err = p.scope(); err != nil {
+			return g, err
+		}
+	} else {
+		for !p.done() && !p.peek().is("TO") {
+			role, err := p.account()
+			if err != nil {
+				return g, err
+			}
+			g.Roles = append(g.Roles, role)
+			if p.peek().is(",") {
+				p.next()
+			}
+		}
+	}
+
+	if err = p.expect("TO"); err != nil {
+		return g, err
+	}
+	if g.Grantee, err = p.account(); err != nil {
+		return g, err
+	}
+	// skip IDENTIFIED BY, REQUIRE and resource limits
+	for !p.done() {
+		if p.next().is("GRANT") && p.peek().is("OPTION") {
+			g.GrantOption = true
+		}
+	}
+	return g, nil
+}
+
+// has reports whether the grant confers the named privilege at the table level
+func (g grant) has(name string) bool {
+	name = strings.ToUpper(name)
+	if name == "GRANT OPTION" {
+		return g.GrantOption
+	}
+	for _, v := range g.Privileges {
+		if len(v.Columns) > 0 {
+			continue
+		}
+		if v.Name == name {
+			return true
+		}
+		// ALL excludes GRANT OPTION and PROXY
+		if (v.Name == "ALL" || v.Name == "ALL PRIVILEGES") && name != "PROXY" {
+			return true
+		}
+	}
+	return false
+}
+
+// covers reports whether the grant's scope includes s
+func (g grant) covers(s scope) bool {
+	if g.Proxied != nil || len(g.Roles) > 0 {
+		return false
+	}
+	on := g.On
+	switch {
+	case on.Schema == "*":
+		return true
+	case s.Schema == "*":
+		return false
+	case on.Table == "*":
+		return likeMatch(on.Schema, s.Schema)
+	case s.Table == "*":
+		return false
+	}
+	sameObject := on.Object == s.Object || (on.Object == "TABLE" && s.Object == "") || (on.Object == "" && s.Object == "TABLE")
+	return sameObject && on.Schema == s.Schema && on.Table == s.Table
+}
+
+// likeMatch matches a schema level grant, where % and _ are wildcards unless
+// escaped with a backslash
+func likeMatch(pattern, s string) bool {
+	p, r := []rune(pattern), []rune(s)
+	if len(p) == 0 {
+		return len(r) == 0
+	}
+	switch p[0] {
+	case '%':
+		for i := 0; i <= len(r); i++ {
+			if likeMatch(string(p[1:]), string(r[i:])) {
+				return true
+			}
+		}
+		return false
+	case '_':
+		return len(r) > 0 && likeMatch(string(p[1:]), string(r[1:]))
+	case '\\':
+		if len(p) > 1 {
+			p = p[1:]
+		}
+	}
+	return len(r) > 0 && p[0] == r[0] && likeMatch(string(p[1:]), string(r[1:]))
+}
+
+// requiredGrant declares privileges a user must hold, on every host it is
+// defined for unless Host narrows it to one
+type requiredGrant struct {
+	User       string   `json:"user"`
+	Host       string   `json:"host,omitempty"`
+	Privileges []string `json:"privileges"`
+	// On is *.*, schema.*, schema.table or PROCEDURE schema.name
+	On string `json:"on"`
+}
+
+func (r requiredGrant) scope() (scope, error) {
+	tokens, err := lexGrant(r.On)
+	if err != nil {
+		return scope{}, err
+	}
+	p := &grantParser{tokens: tokens}
+	s, err := p.scope()
+	if err == nil && !p.done() {
+		err = fmt.Errorf("unexpected %q", p.peek().text)
+	}
+	if err != nil {
+		return s, fmt.Errorf("invalid scope %q: %w", r.On, err)
+	}
+	return s, nil
+}
+
+// accounts lists the hosts a user is defined for
+func (h handler) accounts(user, host string) (accounts []account, err error) {
+	err = h.probe("accounts/"+user+"@"+host, &accounts, func() error {
+		if host != "" {
+			err = h.db.Select(&accounts, `SELECT user, host FROM mysql.user WHERE user = ? AND host = ?`, user, host)
+		} else {
+			err = h.db.Select(&accounts, `SELECT user, host FROM mysql.user WHERE user = ? ORDER BY host`, user)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to select %s: %w", user, err)
+		}
+		return nil
+	})
+	return accounts, err
+}
+
+// grants parses the grants held by an account
+func (h handler) grants(a account) (grants []grant, err error) {
+	var rows []string
+	err = h.probe("grants/"+a.String(), &rows, func() error {
+		return h.db.Select(&rows, "SHOW GRANTS FOR "+a.quoted())
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get grants for %s: %w", a, err)
+	}
+	for _, v := range rows {
+		g, err := parseGrant(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse grant %q: %w", v, err)
+		}
+		grants = append(grants, g)
+	}
+	return grants, nil
+}
+
+// missingPrivileges evaluates a requirement against every account it applies
+// to, finding accounts that do not exist or lack a privilege
+func (h handler) missingPrivileges(c Check, r requiredGrant) (findings []Finding, err error) {
+	s, err := r.scope()
+	if err != nil {
+		return nil, err
+	}
+	accounts, err := h.accounts(r.User, r.Host)
+	if err != nil {
+		return nil, err
+	}
+	if len(accounts) == 0 {
+		name := r.User
+		if r.Host != "" {
+			name = account{r.User, r.Host}.String()
+		}
+		return []Finding{newFinding(c, name, "%s does not exist", name)}, nil
+	}
+	for _, a := range accounts {
+		grants, err := h.grants(a)
+		if err != nil {
+			return nil, err
+		}
+		var missing []string
+		for _, name := range r.Privileges {
+			granted := false
+			for _, g := range grants {
+				if g.has(name) && g.covers(s) {
+					granted = true
+					break
+				}
+			}
+			if !granted {
+				missing = append(missing, strings.ToUpper(name))
+			}
+		}
+		if len(missing) > 0 {
+			findings = append(findings, newFinding(c, a.String(), "lacks %s on %s", strings.Join(missing, ", "), s).withKind(s.String()))
+		}
+	}
+	return findings, nil
+}
+
+type grantsCheck struct{ h handler }
+
+func (grantsCheck) ID() string { return "grants" }
+func (grantsCheck) Description() string {
+	return "accounts hold the privileges the policy requires"
+}
+func (grantsCheck) Severity() Severity { return SeverityCritical }
+
+func (c grantsCheck) Run(ctx context.Context) (findings []Finding, err error) {
+	for _, r := range c.h.policy.Grants {
+		missing, err := c.h.missingPrivileges(c, r)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, missing...)
+	}
+	return findings, nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseGrant(t *testing.T) {
+	tests := []struct {
+		statement string
+		want      grant
+	}{
+		{
+			statement: "GRANT USAGE ON *.* TO 'lambda_invoker'@'%'",
+			want: grant{
+				Privileges: []privilege{{Name: "USAGE"}},
+				On:         scope{Schema: "*", Table: "*"},
+				Grantee:    account{"lambda_invoker", "%"},
+			},
+		},
+		{
+			statement: "GRANT SELECT, INSERT, UPDATE, DELETE ON `bugzilla`.* TO 'bugzilla'@'%'",
+			want: grant{
+				Privileges: []privilege{{Name: "SELECT"}, {Name: "INSERT"}, {Name: "UPDATE"}, {Name: "DELETE"}},
+				On:         scope{Schema: "bugzilla", Table: "*"},
+				Grantee:    account{"bugzilla", "%"},
+			},
+		},
+		{
+			statement: "GRANT ALL PRIVILEGES ON `unee\\_t\\_enterprise`.* TO 'root'@'%' WITH GRANT OPTION",
+			want: grant{
+				Privileges:  []privilege{{Name: "ALL PRIVILEGES"}},
+				On:          scope{Schema: `unee\_t\_enterprise`, Table: "*"},
+				Grantee:     account{"root", "%"},
+				GrantOption: true,
+			},
+		},
+		{
+			statement: "GRANT LOAD FROM S3, SELECT INTO S3, INVOKE LAMBDA ON *.* TO 'rds_superuser'@'%'",
+			want: grant{
+				Privileges: []privilege{{Name: "LOAD FROM S3"}, {Name: "SELECT INTO S3"}, {Name: "INVOKE LAMBDA"}},
+				On:         scope{Schema: "*", Table: "*"},
+				Grantee:    account{"rds_superuser", "%"},
+			},
+		},
+		{
+			statement: "GRANT SELECT (`id`, `name`), UPDATE (`name`) ON `bugzilla`.`profiles` TO 'app'@'10.0.%'",
+			want: grant{
+				Privileges: []privilege{{Name: "SELECT", Columns: []string{"id", "name"}}, {Name: "UPDATE", Columns: []string{"name"}}},
+				On:         scope{Schema: "bugzilla", Table: "profiles"},
+				Grantee:    account{"app", "10.0.%"},
+			},
+		},
+		{
+			statement: "GRANT EXECUTE, ALTER ROUTINE ON PROCEDURE `bugzilla`.`lambda_notification_message` TO 'app'@'%'",
+			want: grant{
+				Privileges: []privilege{{Name: "EXECUTE"}, {Name: "ALTER ROUTINE"}},
+				On:         scope{Object: "PROCEDURE", Schema: "bugzilla", Table: "lambda_notification_message"},
+				Grantee:    account{"app", "%"},
+			},
+		},
+		{
+			statement: "GRANT PROXY ON ''@'' TO 'root'@'%' WITH GRANT OPTION",
+			want: grant{
+				Privileges:  []privilege{{Name: "PROXY"}},
+				Proxied:     &account{"", ""},
+				Grantee:     account{"root", "%"},
+				GrantOption: true,
+			},
+		},
+		{
+			statement: "GRANT `reader`@`%`,`writer`@`%` TO `app`@`%`",
+			want: grant{
+				Roles:   []account{{"reader", "%"}, {"writer", "%"}},
+				Grantee: account{"app", "%"},
+			},
+		},
+		{
+			statement: "GRANT USAGE ON *.* TO 'o''brien'@'localhost' IDENTIFIED BY PASSWORD '*2470C0C06DEE42FD1618BB99005ADCA2EC9D1E19'",
+			want: grant{
+				Privileges: []privilege{{Name: "USAGE"}},
+				On:         scope{Schema: "*", Table: "*"},
+				Grantee:    account{"o'brien", "localhost"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		got, err := parseGrant(tt.statement)
+		if err != nil {
+			t.Errorf("parseGrant(%q) error: %v", tt.statement, err)
+			continue
+		}
+		tt.want.Statement = tt.statement
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseGrant(%q)\n got %+v\nwant %+v", tt.statement, got, tt.want)
+		}
+	}
+}
+
+func TestParseGrantErrors(t *testing.T) {
+	for _, statement := range []string{
+		"REVOKE SELECT ON *.* FROM 'app'@'%'",
+		"GRANT SELECT ON `bugzilla` TO 'app'@'%'",
+		"GRANT SELECT ON `bugzilla`.* TO 'app",
+		"GRANT ON *.* TO 'app'@'%'",
+	} {
+		if _, err := parseGrant(statement); err == nil {
+			t.Errorf("parseGrant(%q) succeeded, want an error", statement)
+		}
+	}
+}
+
+func TestGrantCovers(t *testing.T) {
+	tests := []struct {
+		statement string
+		privilege string
+		on        string
+		want      bool
+	}{
+		{"GRANT EXECUTE ON `bugzilla`.* TO 'lambda_invoker'@'%'", "EXECUTE", "`bugzilla`.*", true},
+		{"GRANT EXECUTE ON `bugzilla`.* TO 'lambda_invoker'@'%'", "execute", "PROCEDURE bugzilla.lambda_notification", true},
+		{"GRANT EXECUTE ON `bugzilla`.* TO 'lambda_invoker'@'%'", "EXECUTE", "unee_t_enterprise.*", false},
+		{"GRANT EXECUTE ON `bugzilla`.* TO 'lambda_invoker'@'%'", "EXECUTE", "*.*", false},
+		{"GRANT SELECT ON *.* TO 'reader'@'%'", "SELECT", "bugzilla.profiles", true},
+		{"GRANT ALL PRIVILEGES ON *.* TO 'root'@'%'", "DELETE", "bugzilla.*", true},
+		{"GRANT ALL PRIVILEGES ON *.* TO 'root'@'%'", "GRANT OPTION", "*.*", false},
+		{"GRANT ALL PRIVILEGES ON *.* TO 'root'@'%' WITH GRANT OPTION", "GRANT OPTION", "*.*", true},
+		// an escaped _ only matches itself, an unescaped one any character
+		{"GRANT SELECT ON `unee\\_t\\_enterprise`.* TO 'app'@'%'", "SELECT", "unee_t_enterprise.*", true},
+		{"GRANT SELECT ON `unee\\_t\\_enterprise`.* TO 'app'@'%'", "SELECT", "uneextxenterprise.*", false},
+		{"GRANT SELECT ON `unee_t_enterprise`.* TO 'app'@'%'", "SELECT", "uneextxenterprise.*", true},
+		{"GRANT SELECT ON `bugzilla%`.* TO 'app'@'%'", "SELECT", "bugzilla_archive.*", true},
+		// a column grant does not confer the privilege on the table
+		{"GRANT SELECT (`id`) ON `bugzilla`.`profiles` TO 'app'@'%'", "SELECT", "bugzilla.profiles", false},
+		{"GRANT SELECT ON `bugzilla`.`profiles` TO 'app'@'%'", "SELECT", "bugzilla.profiles", true},
+		{"GRANT SELECT ON `bugzilla`.`profiles` TO 'app'@'%'", "SELECT", "bugzilla.*", false},
+		{"GRANT EXECUTE ON PROCEDURE `bugzilla`.`a` TO 'app'@'%'", "EXECUTE", "PROCEDURE bugzilla.a", true},
+		{"GRANT EXECUTE ON PROCEDURE `bugzilla`.`a` TO 'app'@'%'", "EXECUTE", "FUNCTION bugzilla.a", false},
+		{"GRANT PROXY ON ''@'' TO 'root'@'%'", "PROXY", "*.*", false},
+		{"GRANT `dba`@`%` TO `app`@`%`", "SELECT", "*.*", false},
+	}
+	for _, tt := range tests {
+		g, err := parseGrant(tt.statement)
+		if err != nil {
+			t.Fatalf("parseGrant(%q) error: %v", tt.statement, err)
+		}
+		s, err := requiredGrant{On: tt.on}.scope()
+		if err != nil {
+			t.Fatalf("scope(%q) error: %v", tt.on, err)
+		}
+		if got := g.has(tt.privilege) && g.covers(s); got != tt.want {
+			t.Errorf("%q grants %s on %s = %v, want %v", tt.statement, tt.privilege, tt.on, got, tt.want)
+		}
+	}
+}
+
+func TestLikeMatch(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"bugzilla", "bugzilla", true},
+		{"bugzilla", "bugzilla2", false},
+		{"bug%", "bugzilla", true},
+		{"%", "", true},
+		{"b_g", "bug", true},
+		{"b_g", "bg", false},
+		{`b\_g`, "b_g", true},
+		{`b\_g`, "bug", false},
+		{`100\%`, "100%", true},
+		{`100\%`, "1000", false},
+	}
+	for _, tt := range tests {
+		if got := likeMatch(tt.pattern, tt.s); got != tt.want {
+			t.Errorf("likeMatch(%q, %q) = %v, want %v", tt.pattern, tt.s, got, tt.want)
+		}
+	}
+}
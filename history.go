@@ -0,0 +1,367 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/tj/go/http/response"
+)
+
+const (
+	// historyPoints is how many changes of each value are kept
+	historyPoints = 500
+	// historyRetention is how long resolved findings are kept
+	historyRetention = 90 * 24 * time.Hour
+	// historySaveInterval is how long an evaluation that only extends
+	// what is already recorded may go unsaved
+	historySaveInterval = 5 * time.Minute
+)
+
+// findingHistory is a finding's lifetime, from the evaluation that first
+// raised it to the one that no longer did
+type findingHistory struct {
+	Finding
+	FirstSeen time.Time  `json:"first_seen"`
+	LastSeen  time.Time  `json:"last_seen"`
+	Resolved  *time.Time `json:"resolved,omitempty"`
+}
+
+func (f findingHistory) key() string {
+	return strings.Join([]string{f.Account, f.Cluster, f.Check, f.Subject, f.Kind}, "\x00")
+}
+
+// valueHistory is a period a key value held, a new one starts when it changes
+type valueHistory struct {
+	Account   string    `json:"account"`
+	Cluster   string    `json:"cluster"`
+	Name      string    `json:"name"`
+	Value     string    `json:"value"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+type valueKey struct{ account, cluster, name string }
+
+// historyStore keeps findings and key values across evaluations, shared by
+// every target of the fleet, in memory only when it has no path
+type historyStore struct {
+	mu       sync.Mutex
+	path     string
+	findings []findingHistory
+	// values are the periods of each value, oldest first
+	values map[valueKey][]valueHistory
+	// dirty is whether anything but last seen times changed since saved
+	dirty bool
+	saved time.Time
+}
+
+// historyFile is how a historyStore is written
+type historyFile struct {
+	Findings []findingHistory `json:"findings"`
+	Values   []valueHistory   `json:"values"`
+}
+
+// historyPath is DBCHECK_HISTORY, defaulting to /tmp on Lambda where it only
+// survives while the function is warm
+func historyPath() string {
+	if v := os.Getenv("DBCHECK_HISTORY"); v != "" {
+		return v
+	}
+	if os.Getenv("UP_STAGE") != "" {
+		return filepath.Join(os.TempDir(), "dbcheck-history.json")
+	}
+	return ""
+}
+
+func openHistory(path string) (*historyStore, error) {
+	s := &historyStore{path: path}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file historyFile
+	err = json.Unmarshal(b, &file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	s.findings = file.Findings
+	s.values = map[valueKey][]valueHistory{}
+	for _, v := range file.Values {
+		k := valueKey{v.Account, v.Cluster, v.Name}
+		s.values[k] = append(s.values[k], v)
+	}
+	return s, nil
+}
+
+// save replaces the file so a crash never leaves it half written. Unless
+// something changed it waits historySaveInterval, so scrapes that only see
+// the same findings and values again do not rewrite it every time.
+func (s *historyStore) save(now time.Time) error {
+	if s.path == "" || !s.dirty && now.Sub(s.saved) < historySaveInterval {
+		return nil
+	}
+	file := historyFile{Findings: s.findings}
+	for _, k := range s.keys() {
+		file.Values = append(file.Values, s.values[k]...)
+	}
+	b, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	err = ioutil.WriteFile(tmp, b, 0600)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp, s.path)
+	if err != nil {
+		return err
+	}
+	s.dirty, s.saved = false, now
+	return nil
+}
+
+// keys are the values held, sorted
+func (s *historyStore) keys() (keys []valueKey) {
+	for k := range s.values {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.account != b.account {
+			return a.account < b.account
+		}
+		if a.cluster != b.cluster {
+			return a.cluster < b.cluster
+		}
+		return a.name < b.name
+	})
+	return keys
+}
+
+// findingChange is a finding that appeared, changed severity or resolved in
+// an evaluation, a finding that stands unchanged is not a change
+type findingChange struct {
+	Change   string         `json:"change"`
+	Previous *Severity      `json:"previous_severity,omitempty"`
+	Finding  findingHistory `json:"finding"`
+}
+
+const (
+	changeAppeared = "appeared"
+	changeSeverity = "severity"
+	changeResolved = "resolved"
+)
+
+// record merges an evaluation of one target, open findings it no longer
+// raises are resolved
+func (s *historyStore) record(account, cluster string, findings []Finding, values map[string]string, now time.Time) (changes []findingChange, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	open := map[string]int{}
+	for i, f := range s.findings {
+		if f.Resolved == nil {
+			open[f.key()] = i
+		}
+	}
+	seen := map[string]bool{}
+	failed := map[string]bool{}
+	for _, f := range findings {
+		if f.Kind == kindFailed {
+			failed[f.Check] = true
+		}
+		h := findingHistory{Finding: f, FirstSeen: now, LastSeen: now}
+		k := h.key()
+		// a check repeating the very same finding is recorded once
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		if i, ok := open[k]; ok {
+			previous := s.findings[i].Severity
+			s.findings[i].Severity = f.Severity
+			s.findings[i].Message = f.Message
+			s.findings[i].LastSeen = now
+			if previous != f.Severity {
+				changes = append(changes, findingChange{Change: changeSeverity, Previous: &previous, Finding: s.findings[i]})
+				s.dirty = true
+			}
+			continue
+		}
+		s.findings = append(s.findings, h)
+		open[k] = len(s.findings) - 1
+		changes = append(changes, findingChange{Change: changeAppeared, Finding: h})
+		s.dirty = true
+	}
+	// a check that failed to run says nothing about its open findings, so
+	// they are left open rather than resolved and raised again once it recovers
+	var kept []findingHistory
+	for _, f := range s.findings {
+		if f.Resolved == nil && f.Account == account && f.Cluster == cluster && !seen[f.key()] && !failed[f.Check] {
+			resolved := now
+			f.Resolved = &resolved
+			changes = append(changes, findingChange{Change: changeResolved, Finding: f})
+			s.dirty = true
+		}
+		if f.Resolved != nil && now.Sub(*f.Resolved) > historyRetention {
+			s.dirty = true
+			continue
+		}
+		kept = append(kept, f)
+	}
+	s.findings = kept
+
+	for name, value := range values {
+		s.observe(account, cluster, name, value, now)
+	}
+	return changes, s.save(now)
+}
+
+// observe extends the current period of a value or starts a new one
+func (s *historyStore) observe(account, cluster, name, value string, now time.Time) {
+	if s.values == nil {
+		s.values = map[valueKey][]valueHistory{}
+	}
+	k := valueKey{account, cluster, name}
+	periods := s.values[k]
+	if n := len(periods); n > 0 && periods[n-1].Value == value {
+		periods[n-1].LastSeen = now
+		return
+	}
+	periods = append(periods, valueHistory{
+		Account:   account,
+		Cluster:   cluster,
+		Name:      name,
+		Value:     value,
+		FirstSeen: now,
+		LastSeen:  now,
+	})
+	if len(periods) > historyPoints {
+		periods = periods[len(periods)-historyPoints:]
+	}
+	s.values[k] = periods
+	s.dirty = true
+}
+
+// series returns the periods of a value, oldest first
+func (s *historyStore) series(account, cluster, name string) (periods []valueHistory) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append(periods, s.values[valueKey{account, cluster, name}]...)
+}
+
+// changed observes a value and returns the one it replaced and when, while
+// that change is younger than window
+func (s *historyStore) changed(account, cluster, name, value string, window time.Duration, now time.Time) (previous string, at time.Time, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.observe(account, cluster, name, value, now)
+	periods := s.values[valueKey{account, cluster, name}]
+	if len(periods) < 2 {
+		return "", at, false
+	}
+	current := periods[len(periods)-1]
+	if now.Sub(current.FirstSeen) > window {
+		return "", at, false
+	}
+	return periods[len(periods)-2].Value, current.FirstSeen, true
+}
+
+// query returns a target's history, optionally narrowed to a check's findings
+// and to values whose name starts with prefix
+func (s *historyStore) query(account, cluster, check, prefix string) (findings []findingHistory, values []valueHistory) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	findings, values = []findingHistory{}, []valueHistory{}
+	for _, f := range s.findings {
+		if f.Account == account && f.Cluster == cluster && (check == "" || f.Check == check) {
+			findings = append(findings, f)
+		}
+	}
+	for _, k := range s.keys() {
+		if k.account == account && k.cluster == cluster && strings.HasPrefix(k.name, prefix) {
+			values = append(values, s.values[k]...)
+		}
+	}
+	return findings, values
+}
+
+// keepHistory gives a server without DBCHECK_HISTORY a history in memory, so
+// notifications are still deduplicated while it runs
+func (f fleet) keepHistory() {
+	history := &historyStore{}
+	for i := range f {
+		if f[i].history == nil {
+			f[i].history = history
+		}
+	}
+}
+
+// keyValues are the values worth charting, the schema and engine version,
+// watchlist row counts and the used fraction of every auto_increment key
+func (h handler) keyValues() map[string]string {
+	values := map[string]string{}
+	if v := h.schemaversion(); v != "" {
+		values["schema_version"] = v
+	}
+	if v := h.engineVersion(); v != "" {
+		values["engine_version"] = v
+	}
+	for _, table := range h.policy.Watchlist {
+		if current, ok := h.rowCounts.last(table); ok {
+			values["row_count/"+table] = strconv.FormatInt(current.Rows, 10)
+		}
+	}
+	keys, err := h.autoIncrements()
+	if err != nil {
+		log.WithError(err).Error("failed to get auto_increment headroom for history")
+	}
+	for _, v := range keys {
+		values["auto_increment_used/"+v.Schema+"."+v.Table+"."+v.Column] = strconv.FormatFloat(v.Used, 'f', 4, 64)
+	}
+	return values
+}
+
+// recordHistory stores an evaluation and notifies what changed, a no-op when
+// linting a snapshot
+func (h handler) recordHistory(findings []Finding) {
+	if h.history == nil {
+		return
+	}
+	changes, err := h.history.record(h.AccountID, h.Cluster, findings, h.keyValues(), time.Now())
+	if err != nil {
+		log.WithError(err).Error("failed to record history")
+	}
+	h.notify(changes)
+}
+
+type historyReport struct {
+	Findings []findingHistory `json:"findings"`
+	Values   []valueHistory   `json:"values"`
+}
+
+// showHistory serves the history of a target, ?check= narrows findings and
+// ?name= narrows values by prefix
+func (h handler) showHistory(w http.ResponseWriter, r *http.Request) {
+	if h.history == nil {
+		http.Error(w, "no history is kept", http.StatusNotFound)
+		return
+	}
+	q := r.URL.Query()
+	findings, values := h.history.query(h.AccountID, h.Cluster, q.Get("check"), q.Get("name"))
+	response.JSON(w, historyReport{Findings: findings, Values: values})
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestHistoryRecord(t *testing.T) {
+	s := &historyStore{}
+	now := time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC)
+	maintenance := Finding{Account: "a", Cluster: "c", Check: "backup", Severity: SeverityWarning, Subject: "PreferredBackupWindow", Kind: "maintenance"}
+	business := Finding{Account: "a", Cluster: "c", Check: "backup", Severity: SeverityWarning, Subject: "PreferredBackupWindow", Kind: "business_hours"}
+	critical := business
+	critical.Severity = SeverityCritical
+	failed := Finding{Account: "a", Cluster: "c", Check: "backup", Severity: SeverityCritical, Kind: kindFailed}
+
+	changes := func(findings ...Finding) (got []string) {
+		now = now.Add(time.Minute)
+		cc, err := s.record("a", "c", findings, nil, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range cc {
+			got = append(got, c.Change+" "+c.Finding.Kind)
+		}
+		return got
+	}
+	steps := []struct {
+		findings []Finding
+		want     []string
+	}{
+		{[]Finding{maintenance, business}, []string{"appeared maintenance", "appeared business_hours"}},
+		{[]Finding{maintenance, business}, nil},
+		{[]Finding{business}, []string{"resolved maintenance"}},
+		{[]Finding{critical}, []string{"severity business_hours"}},
+		{nil, []string{"resolved business_hours"}},
+		{[]Finding{maintenance}, []string{"appeared maintenance"}},
+		{[]Finding{failed}, []string{"appeared failed"}},
+		{[]Finding{maintenance}, []string{"resolved failed"}},
+	}
+	for i, step := range steps {
+		if got := changes(step.findings...); !reflect.DeepEqual(got, step.want) {
+			t.Errorf("evaluation %d changed %q, want %q", i, got, step.want)
+		}
+	}
+	if findings, _ := s.query("a", "c", "backup", ""); len(findings) != 4 {
+		t.Errorf("kept %d findings, want 4", len(findings))
+	}
+}
+
+func TestHistoryChanged(t *testing.T) {
+	s := &historyStore{}
+	start := time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC)
+	window := 24 * time.Hour
+	steps := []struct {
+		value string
+		after time.Duration
+		want  bool
+	}{
+		{"a", 0, false},
+		{"a", 10 * time.Hour, false},
+		{"b", 20 * time.Hour, true},
+		{"b", 40 * time.Hour, true},
+		{"b", 50 * time.Hour, false},
+	}
+	for _, step := range steps {
+		previous, at, ok := s.changed("a", "c", "procedure/bugzilla.p", step.value, window, start.Add(step.after))
+		if ok != step.want {
+			t.Errorf("after %s changed = %v, want %v", step.after, ok, step.want)
+		}
+		if ok && (previous != "a" || !at.Equal(start.Add(20*time.Hour))) {
+			t.Errorf("after %s changed from %q at %s", step.after, previous, at)
+		}
+	}
+}
+
+func TestHistorySave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbcheck")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "history.json")
+	s, err := openHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC)
+	finding := Finding{Account: "a", Cluster: "c", Check: "backup", Severity: SeverityWarning, Subject: "PreferredBackupWindow"}
+
+	steps := []struct {
+		after  time.Duration
+		values map[string]string
+		saved  bool
+	}{
+		{0, map[string]string{"schema_version": "23"}, true},
+		// the same finding and value only extend what is recorded
+		{time.Minute, map[string]string{"schema_version": "23"}, false},
+		{2 * time.Minute, map[string]string{"schema_version": "24"}, true},
+		{3 * time.Minute, map[string]string{"schema_version": "24"}, false},
+		{2*time.Minute + historySaveInterval, map[string]string{"schema_version": "24"}, true},
+	}
+	for i, step := range steps {
+		os.Remove(path)
+		_, err := s.record("a", "c", []Finding{finding}, step.values, now.Add(step.after))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(path); (err == nil) != step.saved {
+			t.Errorf("evaluation %d saved = %v, want %v", i, err == nil, step.saved)
+		}
+	}
+
+	s, err = openHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	periods := s.series("a", "c", "schema_version")
+	if len(periods) != 2 || periods[0].Value != "23" || periods[1].Value != "24" {
+		t.Errorf("reopened schema_version periods %+v, want 23 then 24", periods)
+	}
+	if findings, _ := s.query("a", "c", "", ""); len(findings) != 1 {
+		t.Errorf("reopened %d findings, want 1", len(findings))
+	}
+}
+
+func TestHistoryPoints(t *testing.T) {
+	s := &historyStore{}
+	start := time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < historyPoints+10; i++ {
+		s.observe("a", "c", "row_count/bugzilla.profiles", strconv.Itoa(i), start.Add(time.Duration(i)*time.Minute))
+	}
+	s.observe("a", "c", "schema_version", "23", start)
+	periods := s.series("a", "c", "row_count/bugzilla.profiles")
+	if len(periods) != historyPoints || periods[0].Value != "10" || periods[len(periods)-1].Value != strconv.Itoa(historyPoints+9) {
+		t.Errorf("kept %d periods from %s, want %d from 10", len(periods), periods[0].Value, historyPoints)
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+)
+
+// invokeAction is what Aurora needs to call a function with mysql.lambda_async
+const invokeAction = "lambda:InvokeFunction"
+
+// stringList is an IAM policy element that is either a string or a list
+type stringList []string
+
+func (l *stringList) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*l = stringList{s}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(l))
+}
+
+type policyStatement struct {
+	Sid         string          `json:"Sid,omitempty"`
+	Effect      string          `json:"Effect"`
+	Action      stringList      `json:"Action,omitempty"`
+	NotAction   stringList      `json:"NotAction,omitempty"`
+	Resource    stringList      `json:"Resource,omitempty"`
+	NotResource stringList      `json:"NotResource,omitempty"`
+	Condition   json.RawMessage `json:"Condition,omitempty"`
+}
+
+type statementList []policyStatement
+
+func (l *statementList) UnmarshalJSON(b []byte) error {
+	var s policyStatement
+	if err := json.Unmarshal(b, &s); err == nil && s.Effect != "" {
+		*l = statementList{s}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]policyStatement)(l))
+}
+
+type policyDocument struct {
+	Version   string        `json:"Version"`
+	Statement statementList `json:"Statement"`
+}
+
+// rolePolicy is a policy document and where it came from
+type rolePolicy struct {
+	Role     string
+	Name     string // the ARN of managed policies, the name of inline ones
+	Inline   bool
+	Document policyDocument
+}
+
+// iamMatch matches IAM wildcards, * for any run of characters and ? for one
+func iamMatch(pattern, s string, fold bool) bool {
+	if fold {
+		pattern, s = strings.ToLower(pattern), strings.ToLower(s)
+	}
+	if pattern == "" {
+		return s == ""
+	}
+	switch pattern[0] {
+	case '*':
+		for i := 0; i <= len(s); i++ {
+			if iamMatch(pattern[1:], s[i:], false) {
+				return true
+			}
+		}
+		return false
+	case '?':
+		return s != "" && iamMatch(pattern[1:], s[1:], false)
+	}
+	return s != "" && pattern[0] == s[0] && iamMatch(pattern[1:], s[1:], false)
+}
+
+func anyMatch(patterns stringList, s string, fold bool) bool {
+	for _, p := range patterns {
+		if iamMatch(p, s, fold) {
+			return true
+		}
+	}
+	return false
+}
+
+// applies reports whether the statement is about action on resource
+func (s policyStatement) applies(action, resource string) bool {
+	if len(s.Action) > 0 && !anyMatch(s.Action, action, true) {
+		return false
+	}
+	if len(s.NotAction) > 0 && anyMatch(s.NotAction, action, true) {
+		return false
+	}
+	if len(s.Resource) > 0 && !anyMatch(s.Resource, resource, false) {
+		return false
+	}
+	if len(s.NotResource) > 0 && anyMatch(s.NotResource, resource, false) {
+		return false
+	}
+	return true
+}
+
+func (s *policyStatement) String() string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+// policyDecision is the outcome of evaluating role policies for a request
+type policyDecision struct {
+	Allowed   bool             `json:"allowed"`
+	Role      string           `json:"role,omitempty"`
+	Policy    string           `json:"policy,omitempty"`
+	Inline    bool             `json:"inline,omitempty"`
+	Statement *policyStatement `json:"statement,omitempty"`
+	Reason    string           `json:"reason"`
+}
+
+// evaluate applies IAM's identity policy logic, an explicit deny beats any
+// allow and otherwise access is implicitly denied. Conditions depend on the
+// request, so a conditional deny is assumed to apply and a conditional allow
+// is not relied on.
+func evaluate(policies []rolePolicy, action, resource string) (d policyDecision) {
+	d.Reason = "no statement allows it"
+	for _, p := range policies {
+		for i := range p.Document.Statement {
+			s := &p.Document.Statement[i]
+			if !s.applies(action, resource) {
+				continue
+			}
+			switch {
+			case strings.EqualFold(s.Effect, "Deny"):
+				return policyDecision{Role: p.Role, Policy: p.Name, Inline: p.Inline, Statement: s, Reason: "explicitly denied"}
+			case !strings.EqualFold(s.Effect, "Allow") || d.Allowed:
+				// the first granting statement is reported
+			case len(s.Condition) > 0:
+				d.Reason = "only allowed under a condition"
+			default:
+				d = policyDecision{Allowed: true, Role: p.Role, Policy: p.Name, Inline: p.Inline, Statement: s, Reason: "allowed"}
+			}
+		}
+	}
+	return d
+}
+
+// roleName is the last element of a role ARN's resource, after any path
+func roleName(roleArn string) (string, error) {
+	a, err := arn.Parse(roleArn)
+	if err != nil {
+		return "", err
+	}
+	return a.Resource[strings.LastIndex(a.Resource, "/")+1:], nil
+}
+
+// rolePolicies fetches the documents of every managed policy attached to the
+// role and every inline policy embedded in it
+func (h handler) rolePolicies(ctx context.Context, roleArn string) (policies []rolePolicy, err error) {
+	err = h.probe("role_policies/"+roleArn, &policies, func() error {
+		name, err := roleName(roleArn)
+		if err != nil {
+			return fmt.Errorf("failed to parse role %s: %w", roleArn, err)
+		}
+		svc := iam.New(h.AWSCfg)
+
+		attached := iam.NewListAttachedRolePoliciesPaginator(svc.ListAttachedRolePoliciesRequest(&iam.ListAttachedRolePoliciesInput{
+			RoleName: aws.String(name),
+		}))
+		for attached.Next(ctx) {
+			for _, v := range attached.CurrentPage().AttachedPolicies {
+				doc, err := h.managedPolicy(ctx, svc, aws.StringValue(v.PolicyArn))
+				if err != nil {
+					return err
+				}
+				policies = append(policies, rolePolicy{Role: name, Name: aws.StringValue(v.PolicyArn), Document: doc})
+			}
+		}
+		if err := attached.Err(); err != nil {
+			return fmt.Errorf("failed to list policies attached to %s: %w", name, err)
+		}
+
+		inline := iam.NewListRolePoliciesPaginator(svc.ListRolePoliciesRequest(&iam.ListRolePoliciesInput{
+			RoleName: aws.String(name),
+		}))
+		for inline.Next(ctx) {
+			for _, policyName := range inline.CurrentPage().PolicyNames {
+				resp, err := svc.GetRolePolicyRequest(&iam.GetRolePolicyInput{
+					RoleName:   aws.String(name),
+					PolicyName: aws.String(policyName),
+				}).Send(ctx)
+				if err != nil {
+					return fmt.Errorf("failed to get inline policy %s of %s: %w", policyName, name, err)
+				}
+				doc, err := decodePolicyDocument(aws.StringValue(resp.PolicyDocument))
+				if err != nil {
+					return fmt.Errorf("inline policy %s of %s: %w", policyName, name, err)
+				}
+				policies = append(policies, rolePolicy{Role: name, Name: policyName, Inline: true, Document: doc})
+			}
+		}
+		if err := inline.Err(); err != nil {
+			return fmt.Errorf("failed to list inline policies of %s: %w", name, err)
+		}
+		return nil
+	})
+	return policies, err
+}
+
+// managedPolicy fetches the default version of a managed policy
+func (h handler) managedPolicy(ctx context.Context, svc *iam.Client, policyArn string) (doc policyDocument, err error) {
+	p, err := svc.GetPolicyRequest(&iam.GetPolicyInput{PolicyArn: aws.String(policyArn)}).Send(ctx)
+	if err != nil {
+		return doc, fmt.Errorf("failed to get policy %s: %w", policyArn, err)
+	}
+	v, err := svc.GetPolicyVersionRequest(&iam.GetPolicyVersionInput{
+		PolicyArn: aws.String(policyArn),
+		VersionId: p.Policy.DefaultVersionId,
+	}).Send(ctx)
+	if err != nil {
+		return doc, fmt.Errorf("failed to get version %s of %s: %w", aws.StringValue(p.Policy.DefaultVersionId), policyArn, err)
+	}
+	doc, err = decodePolicyDocument(aws.StringValue(v.PolicyVersion.Document))
+	if err != nil {
+		return doc, fmt.Errorf("policy %s: %w", policyArn, err)
+	}
+	return doc, nil
+}
+
+// decodePolicyDocument parses a document as IAM returns it, percent-encoded
+// per RFC 3986 where, unlike a query string, + is not a space
+func decodePolicyDocument(encoded string) (doc policyDocument, err error) {
+	raw, err := url.PathUnescape(encoded)
+	if err != nil {
+		return doc, fmt.Errorf("failed to unescape document: %w", err)
+	}
+	err = json.Unmarshal([]byte(raw), &doc)
+	if err != nil {
+		return doc, fmt.Errorf("failed to parse document: %w", err)
+	}
+	return doc, nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+const testFunction = "arn:aws:lambda:ap-southeast-1:812644853088:function:alambda_simple"
+
+func mustPolicy(t *testing.T, role, name, document string) rolePolicy {
+	t.Helper()
+	doc, err := decodePolicyDocument(url.PathEscape(document))
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return rolePolicy{Role: role, Name: name, Document: doc}
+}
+
+func TestEvaluate(t *testing.T) {
+	const role = "arn:aws:iam::812644853088:role/rds-lambda"
+	tests := []struct {
+		name      string
+		documents []string
+		allowed   bool
+		reason    string
+		statement string
+	}{
+		{
+			name:      "AWSLambdaRole",
+			documents: []string{`{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":["lambda:InvokeFunction"],"Resource":["*"]}]}`},
+			allowed:   true,
+			reason:    "allowed",
+		},
+		{
+			name:      "single statement object and string elements",
+			documents: []string{`{"Version":"2012-10-17","Statement":{"Sid":"Invoke","Effect":"Allow","Action":"lambda:Invoke*","Resource":"arn:aws:lambda:ap-southeast-1:812644853088:function:alambda_*"}}`},
+			allowed:   true,
+			reason:    "allowed",
+			statement: "Invoke",
+		},
+		{
+			name:      "literal + survives decoding",
+			documents: []string{`{"Version":"2012-10-17","Statement":[{"Sid":"Invoke+Lambda","Effect":"Allow","Action":"lambda:InvokeFunction","Resource":"*"}]}`},
+			allowed:   true,
+			reason:    "allowed",
+			statement: "Invoke+Lambda",
+		},
+		{
+			name:      "actions are case insensitive",
+			documents: []string{`{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"Lambda:invokefunction","Resource":"*"}]}`},
+			allowed:   true,
+			reason:    "allowed",
+		},
+		{
+			name:      "another function",
+			documents: []string{`{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"lambda:InvokeFunction","Resource":"arn:aws:lambda:ap-southeast-1:812644853088:function:other"}]}`},
+			reason:    "no statement allows it",
+		},
+		{
+			name:      "another region by ? wildcard",
+			documents: []string{`{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"lambda:InvokeFunction","Resource":"arn:aws:lambda:us-west-?:812644853088:function:*"}]}`},
+			reason:    "no statement allows it",
+		},
+		{
+			name: "deny overrides allow across policies",
+			documents: []string{
+				`{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"lambda:*","Resource":"*"}]}`,
+				`{"Version":"2012-10-17","Statement":[{"Sid":"NoInvoke","Effect":"Deny","Action":"lambda:InvokeFunction","Resource":"*"}]}`,
+			},
+			reason:    "explicitly denied",
+			statement: "NoInvoke",
+		},
+		{
+			name:      "deny of another function",
+			documents: []string{`{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"lambda:InvokeFunction","Resource":"*"},{"Effect":"Deny","Action":"lambda:InvokeFunction","Resource":"arn:aws:lambda:*:*:function:other"}]}`},
+			allowed:   true,
+			reason:    "allowed",
+		},
+		{
+			name:      "NotAction allows everything else",
+			documents: []string{`{"Version":"2012-10-17","Statement":[{"Effect":"Allow","NotAction":"iam:*","Resource":"*"}]}`},
+			allowed:   true,
+			reason:    "allowed",
+		},
+		{
+			name:      "NotAction excludes lambda",
+			documents: []string{`{"Version":"2012-10-17","Statement":[{"Effect":"Allow","NotAction":["lambda:*"],"Resource":"*"}]}`},
+			reason:    "no statement allows it",
+		},
+		{
+			name:      "NotResource denies everything but the function",
+			documents: []string{`{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"lambda:InvokeFunction","Resource":"*"},{"Effect":"Deny","Action":"lambda:InvokeFunction","NotResource":"arn:aws:lambda:ap-southeast-1:812644853088:function:alambda_simple"}]}`},
+			allowed:   true,
+			reason:    "allowed",
+		},
+		{
+			name:      "NotResource denies the function",
+			documents: []string{`{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"lambda:InvokeFunction","Resource":"*"},{"Sid":"OnlyOther","Effect":"Deny","Action":"lambda:InvokeFunction","NotResource":"arn:aws:lambda:ap-southeast-1:812644853088:function:other"}]}`},
+			reason:    "explicitly denied",
+			statement: "OnlyOther",
+		},
+		{
+			name:      "conditional allow is not relied on",
+			documents: []string{`{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"lambda:InvokeFunction","Resource":"*","Condition":{"StringEquals":{"aws:RequestedRegion":"ap-southeast-1"}}}]}`},
+			reason:    "only allowed under a condition",
+		},
+		{
+			name:      "conditional deny is assumed to apply",
+			documents: []string{`{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"lambda:InvokeFunction","Resource":"*"},{"Sid":"Outside","Effect":"Deny","Action":"lambda:*","Resource":"*","Condition":{"Bool":{"aws:SecureTransport":"false"}}}]}`},
+			reason:    "explicitly denied",
+			statement: "Outside",
+		},
+		{
+			name:   "no policies",
+			reason: "no statement allows it",
+		},
+	}
+	for _, tt := range tests {
+		var policies []rolePolicy
+		for _, doc := range tt.documents {
+			policies = append(policies, mustPolicy(t, role, tt.name, doc))
+		}
+		d := evaluate(policies, invokeAction, testFunction)
+		if d.Allowed != tt.allowed || d.Reason != tt.reason {
+			t.Errorf("%s: allowed %v (%s), want %v (%s)", tt.name, d.Allowed, d.Reason, tt.allowed, tt.reason)
+		}
+		if tt.statement != "" && (d.Statement == nil || d.Statement.Sid != tt.statement) {
+			t.Errorf("%s: decided by %v, want statement %s", tt.name, d.Statement, tt.statement)
+		}
+	}
+}
+
+func TestDecodePolicyDocument(t *testing.T) {
+	tests := []struct {
+		encoded  string
+		resource string
+	}{
+		{url.PathEscape(`{"Statement":{"Effect":"Allow","Action":"lambda:*","Resource":"arn:aws:lambda:*:*:function:a+b c"}}`), "arn:aws:lambda:*:*:function:a+b c"},
+		{`%7B%22Statement%22%3A%7B%22Effect%22%3A%22Allow%22%2C%22Resource%22%3A%22a+b%2Bc%22%7D%7D`, "a+b+c"},
+	}
+	for _, tt := range tests {
+		doc, err := decodePolicyDocument(tt.encoded)
+		if err != nil {
+			t.Errorf("decodePolicyDocument(%q) error: %v", tt.encoded, err)
+			continue
+		}
+		if len(doc.Statement) != 1 || len(doc.Statement[0].Resource) != 1 || doc.Statement[0].Resource[0] != tt.resource {
+			t.Errorf("decodePolicyDocument(%q) = %+v, want resource %q", tt.encoded, doc, tt.resource)
+		}
+	}
+}
+
+func TestIAMMatch(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		fold       bool
+		want       bool
+	}{
+		{"*", "", false, true},
+		{"lambda:*", "lambda:InvokeFunction", true, true},
+		{"lambda:invoke*", "lambda:InvokeFunction", true, true},
+		{"lambda:invoke*", "lambda:InvokeFunction", false, false},
+		{"lambda:Invoke?unction", "lambda:InvokeFunction", false, true},
+		{"lambda:Invoke?unction", "lambda:Invokeunction", false, false},
+		{"arn:aws:lambda:*:*:function:alambda_*", testFunction, false, true},
+		{"arn:aws:lambda:*:*:function:alambda_*", testFunction + "x", false, true},
+		{"arn:aws:lambda:*:*:function:other", testFunction, false, false},
+	}
+	for _, tt := range tests {
+		if got := iamMatch(tt.pattern, tt.s, tt.fold); got != tt.want {
+			t.Errorf("iamMatch(%q, %q, %v) = %v, want %v", tt.pattern, tt.s, tt.fold, got, tt.want)
+		}
+	}
+}
+
+func TestRoleName(t *testing.T) {
+	tests := map[string]string{
+		"arn:aws:iam::812644853088:role/rds-lambda":              "rds-lambda",
+		"arn:aws:iam::812644853088:role/service-role/rds-lambda": "rds-lambda",
+	}
+	for roleArn, want := range tests {
+		got, err := roleName(roleArn)
+		if err != nil || got != want {
+			t.Errorf("roleName(%q) = %q, %v, want %q", roleArn, got, err, want)
+		}
+	}
+	if _, err := roleName("rds-lambda"); err == nil {
+		t.Error("roleName of a bare name succeeded, want an error")
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/tj/go/http/response"
+)
+
+func init() {
+	register(func(h handler) Check { return lambdaInvokerCheck{h} })
+	register(func(h handler) Check { return lambdaAccessCheck{h} })
+	register(func(h handler) Check { return procedureCheck{h} })
+}
+
+type lambdaInvokerCheck struct{ h handler }
+
+func (lambdaInvokerCheck) ID() string { return "lambda_invoker" }
+func (lambdaInvokerCheck) Description() string {
+	return "LAMBDA_INVOKER_USERNAME exists and may execute procedures"
+}
+func (lambdaInvokerCheck) Severity() Severity { return SeverityCritical }
+
+// Run requires EXECUTE on each policy schema, granted globally, per schema
+// or by a matching wildcard, for every host the invoker is defined for
+func (c lambdaInvokerCheck) Run(ctx context.Context) (findings []Finding, err error) {
+	h := c.h
+	if h.LambdaInvoker == "" {
+		return []Finding{newFinding(c, "", "LAMBDA_INVOKER_USERNAME is unset")}, nil
+	}
+	for _, schema := range h.policy.Schemas {
+		missing, err := h.missingPrivileges(c, requiredGrant{
+			User:       h.LambdaInvoker,
+			Privileges: []string{"EXECUTE"},
+			On:         "`" + schema + "`.*",
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range missing {
+			f.Message = "LAMBDA_INVOKER_USERNAME: " + f.Message
+			findings = append(findings, f)
+		}
+		if len(missing) == 1 && missing[0].Subject == h.LambdaInvoker {
+			// the invoker does not exist, once is enough
+			break
+		}
+	}
+	return findings, nil
+}
+
+type lambdaAccessCheck struct{ h handler }
+
+func (lambdaAccessCheck) ID() string { return "lambda_access" }
+func (lambdaAccessCheck) Description() string {
+	return "an active cluster role may invoke every Lambda function the procedures call"
+}
+func (lambdaAccessCheck) Severity() Severity { return SeverityCritical }
+
+func (c lambdaAccessCheck) Run(ctx context.Context) (findings []Finding, err error) {
+	access, err := c.h.lambdaAccess(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range access {
+		if v.Allowed {
+			continue
+		}
+		reason := v.Reason
+		if v.Policy != "" {
+			reason += fmt.Sprintf(" by %s of %s: %s", v.Policy, v.Role, v.Statement)
+		}
+		findings = append(findings, newFinding(c, v.Function, "no active cluster role may %s: %s", invokeAction, reason))
+	}
+	return findings, nil
+}
+
+// functionAccess is whether the cluster may invoke a function, and why
+type functionAccess struct {
+	Function string `json:"function"`
+	policyDecision
+}
+
+// lambdaAccess evaluates the policies of every active associated role for
+// each function the procedures call, reporting the statement that grants it
+func (h handler) lambdaAccess(ctx context.Context) (access []functionAccess, err error) {
+	procs, err := h.procedures()
+	if err != nil {
+		return nil, err
+	}
+	functions, err := h.invokedFunctions(procs)
+	if err != nil {
+		return nil, err
+	}
+
+	var roles [][]rolePolicy
+	for _, v := range h.dbInfo.get().Cluster.AssociatedRoles {
+		if aws.StringValue(v.Status) != "ACTIVE" {
+			log.Warnf("%s is %s", aws.StringValue(v.RoleArn), aws.StringValue(v.Status))
+			continue
+		}
+		policies, err := h.rolePolicies(ctx, aws.StringValue(v.RoleArn))
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, policies)
+	}
+
+	for _, fn := range functions {
+		a := functionAccess{Function: fn, policyDecision: policyDecision{Reason: "no active associated role"}}
+		for _, policies := range roles {
+			a.policyDecision = evaluate(policies, invokeAction, fn)
+			if a.Allowed {
+				log.WithFields(log.Fields{"function": fn, "role": a.Role, "policy": a.Policy}).Infof("allowed by %s", a.Statement)
+				break
+			}
+		}
+		access = append(access, a)
+	}
+	return access, nil
+}
+
+// invokedFunctions lists the function ARNs the procedures call, or the policy
+// function in the cluster's own partition, region and account when none do
+func (h handler) invokedFunctions(procs []CreateProcedure) (functions []string, err error) {
+	seen := map[string]bool{}
+	for _, v := range procs {
+		for _, fn := range v.Functions {
+			if !seen[fn] {
+				seen[fn] = true
+				functions = append(functions, fn)
+			}
+		}
+	}
+	if len(functions) > 0 {
+		sort.Strings(functions)
+		return functions, nil
+	}
+	fn, err := h.defaultFunction()
+	if err != nil {
+		return nil, err
+	}
+	return []string{fn}, nil
+}
+
+func (h handler) lambda(w http.ResponseWriter, r *http.Request) {
+	access, err := h.lambdaAccess(r.Context())
+	if err != nil {
+		log.WithError(err).Error("failed to evaluate lambda access")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	response.JSON(w, access)
+}
+
+type procedureCheck struct{ h handler }
+
+func (procedureCheck) ID() string { return "procedures" }
+func (procedureCheck) Description() string {
+	return "stored procedures use the policy character set and call the expected lambda"
+}
+func (procedureCheck) Severity() Severity { return SeverityWarning }
+
+func (c procedureCheck) Run(ctx context.Context) ([]Finding, error) {
+	procs, err := c.h.procedures()
+	if err != nil {
+		return nil, err
+	}
+	return c.findings(procs), nil
+}
+
+func (c procedureCheck) findings(procs []CreateProcedure) (findings []Finding) {
+	for _, v := range procs {
+		subject := v.Database + "." + v.Procedure
+		if !v.CorrectCollation {
+			findings = append(findings, newFinding(c, subject, "DatabaseCollation: %s CharacterSetClient: %s", v.DatabaseCollation, v.CharacterSetClient).withKind("collation"))
+		}
+		for _, problem := range v.LambdaProblems {
+			findings = append(findings, newFinding(c, subject, "Lambda ARN check: %s", problem).withKind(problem))
+		}
+	}
+	return findings
+}
+
+// procedureSources fetches the source of every user defined procedure
+func (h handler) procedureSources() (sources []CreateProcedure, err error) {
+	err = h.probe("procedures", &sources, func() error {
+		pp := []Procedures{}
+		err := h.db.Select(&pp, `SHOW PROCEDURE STATUS`)
+		if err != nil {
+			return fmt.Errorf("failed to make SHOW PROCEDURE STATUS listing: %w", err)
+		}
+		for _, v := range pp {
+			if v.Database == "sys" {
+				continue
+			}
+			if v.Database == "mysql" {
+				continue
+			}
+
+			var src CreateProcedure
+			src.Database = v.Database
+			err := h.db.QueryRow(fmt.Sprintf("SHOW CREATE PROCEDURE %s.%s", quoteIdent(v.Database), quoteIdent(v.Name))).Scan(&src.Procedure, &src.SqlMode, &src.Source, &src.CharacterSetClient, &src.CollationConnection, &src.DatabaseCollation)
+			if err != nil {
+				log.WithError(err).WithField("name", v.Name).Error("failed to get procedure source")
+				continue
+			}
+			sources = append(sources, src)
+		}
+		return nil
+	})
+	return sources, err
+}
+
+// procedures judges the collation of every user defined procedure and the
+// lambda ARNs it calls
+func (h handler) procedures() (procsInfo []CreateProcedure, err error) {
+	cluster, err := h.clusterARN()
+	if err != nil {
+		return nil, err
+	}
+	sources, err := h.procedureSources()
+	if err != nil {
+		return nil, err
+	}
+	for _, src := range sources {
+		var output string
+		for _, s := range lambdaArnCandidateExp.FindAllString(src.Source.String, -1) {
+			fn, problems := validateFunctionARN(s, cluster, h.policy.LambdaFunction)
+			name, _, _ := functionName(fn)
+			output += fmt.Sprintf("Fn: %s Region: %s Account: %s\n", template.HTMLEscapeString(name), template.HTMLEscapeString(fn.Region), template.HTMLEscapeString(fn.AccountID))
+			for _, problem := range problems {
+				output += fmt.Sprintf("<span style='color: red;'>%s</span>\n", template.HTMLEscapeString(problem))
+			}
+			if len(problems) == 0 {
+				src.Functions = append(src.Functions, fn.String())
+			}
+			src.LambdaProblems = append(src.LambdaProblems, problems...)
+		}
+		src.AccountCheck = template.HTML(output)
+
+		if src.DatabaseCollation == h.policy.Collation && src.CharacterSetClient == h.policy.CharacterSet {
+			src.CorrectCollation = true
+		}
+
+		procsInfo = append(procsInfo, src)
+	}
+	return procsInfo, nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/aws/awserr"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+)
+
+func init() {
+	register(func(h handler) Check { return lambdaFunctionCheck{h} })
+}
+
+var (
+	// lambdaArnCandidateExp finds what looks like a lambda ARN in a routine,
+	// arn.Parse decides whether it is one
+	lambdaArnCandidateExp = regexp.MustCompile(`arn:[\w-]*:lambda:[^'"\s]*`)
+	functionNameExp       = regexp.MustCompile(`^[\w-]{1,64}$`)
+)
+
+// clusterARN is the cluster's own partition, region and account
+func (h handler) clusterARN() (arn.ARN, error) {
+	a, err := arn.Parse(aws.StringValue(h.dbInfo.get().Cluster.DBClusterArn))
+	if err != nil {
+		return a, fmt.Errorf("failed to parse cluster ARN: %w", err)
+	}
+	return a, nil
+}
+
+// defaultFunction is the policy function in the cluster's own partition,
+// region and account
+func (h handler) defaultFunction() (string, error) {
+	cluster, err := h.clusterARN()
+	if err != nil {
+		return "", err
+	}
+	return arn.ARN{
+		Partition: cluster.Partition,
+		Service:   "lambda",
+		Region:    cluster.Region,
+		AccountID: cluster.AccountID,
+		Resource:  "function:" + h.policy.LambdaFunction,
+	}.String(), nil
+}
+
+// functionName splits function:name[:qualifier]
+func functionName(a arn.ARN) (name, qualifier string, ok bool) {
+	parts := strings.Split(a.Resource, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] != "function" || !functionNameExp.MatchString(parts[1]) {
+		return "", "", false
+	}
+	if len(parts) == 3 {
+		qualifier = parts[2]
+	}
+	return parts[1], qualifier, true
+}
+
+// validateFunctionARN parses a lambda ARN found in a routine, it must name the
+// policy function in the cluster's own partition, region and account
+func validateFunctionARN(s string, cluster arn.ARN, function string) (fn arn.ARN, problems []string) {
+	fn, err := arn.Parse(s)
+	if err != nil {
+		return fn, []string{fmt.Sprintf("invalid ARN %s: %v", s, err)}
+	}
+	name, _, ok := functionName(fn)
+	if fn.Service != "lambda" || !ok {
+		problems = append(problems, fmt.Sprintf("%s is not a lambda function", s))
+	} else if name != function {
+		problems = append(problems, fmt.Sprintf("Function %s != %s", name, function))
+	}
+	if fn.Partition != cluster.Partition {
+		problems = append(problems, fmt.Sprintf("Partition %s != %s", fn.Partition, cluster.Partition))
+	}
+	if fn.Region != cluster.Region {
+		problems = append(problems, fmt.Sprintf("Region %s != %s", fn.Region, cluster.Region))
+	}
+	if fn.AccountID != cluster.AccountID {
+		problems = append(problems, fmt.Sprintf("Account ID %s != %s", fn.AccountID, cluster.AccountID))
+	}
+	return fn, problems
+}
+
+// functionFinder looks up whether a lambda function exists
+type functionFinder interface {
+	exists(ctx context.Context, fn arn.ARN) (bool, error)
+}
+
+// lambdaAPI asks the Lambda API in the function's own region
+type lambdaAPI struct{ cfg aws.Config }
+
+func (l lambdaAPI) exists(ctx context.Context, fn arn.ARN) (bool, error) {
+	cfg := l.cfg.Copy()
+	cfg.Region = fn.Region
+	_, err := lambda.New(cfg).GetFunctionRequest(&lambda.GetFunctionInput{
+		FunctionName: aws.String(fn.String()),
+	}).Send(ctx)
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == lambda.ErrCodeResourceNotFoundException {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get function %s: %w", fn, err)
+	}
+	return true, nil
+}
+
+// stubFunctions are the function ARNs that exist, loaded from the JSON list
+// named by DBCHECK_LAMBDA_STUB to check routines without the Lambda API
+type stubFunctions map[string]bool
+
+func (s stubFunctions) exists(ctx context.Context, fn arn.ARN) (bool, error) {
+	return s[fn.String()], nil
+}
+
+func loadStubFunctions(path string) (stubFunctions, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var functions []string
+	err = json.NewDecoder(f).Decode(&functions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	stub := stubFunctions{}
+	for _, v := range functions {
+		stub[v] = true
+	}
+	return stub, nil
+}
+
+// newFunctionFinder uses the stub when DBCHECK_LAMBDA_STUB is set
+func newFunctionFinder(cfg aws.Config) (functionFinder, error) {
+	if path := os.Getenv("DBCHECK_LAMBDA_STUB"); path != "" {
+		return loadStubFunctions(path)
+	}
+	return lambdaAPI{cfg}, nil
+}
+
+type lambdaFunctionCheck struct{ h handler }
+
+func (lambdaFunctionCheck) ID() string { return "lambda_functions" }
+func (lambdaFunctionCheck) Description() string {
+	return "every lambda function the procedures call exists"
+}
+func (lambdaFunctionCheck) Severity() Severity { return SeverityCritical }
+
+func (c lambdaFunctionCheck) Run(ctx context.Context) (findings []Finding, err error) {
+	procs, err := c.h.procedures()
+	if err != nil {
+		return nil, err
+	}
+	found := map[string]bool{}
+	for _, v := range procs {
+		for _, s := range v.Functions {
+			exists, ok := found[s]
+			if !ok {
+				fn, err := arn.Parse(s)
+				if err != nil {
+					return nil, err
+				}
+				err = c.h.probe("lambda_function/"+s, &exists, func() (err error) {
+					exists, err = c.h.functions.exists(ctx, fn)
+					return err
+				})
+				if err != nil {
+					return nil, err
+				}
+				found[s] = exists
+			}
+			if !exists {
+				findings = append(findings, newFinding(c, v.Database+"."+v.Procedure, "calls %s which does not exist", s).withKind(s))
+			}
+		}
+	}
+	return findings, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+)
+
+func TestValidateFunctionARN(t *testing.T) {
+	cluster, err := arn.Parse("arn:aws:rds:ap-southeast-1:812644853088:cluster:master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		arn      string
+		problems []string
+	}{
+		{"arn:aws:lambda:ap-southeast-1:812644853088:function:alambda_simple", nil},
+		{"arn:aws:lambda:ap-southeast-1:812644853088:function:alambda_simple:prod", nil},
+		{"arn:aws:lambda:ap-southeast-1:812644853088:function:other", []string{"Function other != alambda_simple"}},
+		{"arn:aws:lambda:ap-southeast-1:192458993663:function:alambda_simple", []string{"Account ID 192458993663 != 812644853088"}},
+		{"arn:aws:lambda:us-west-2:812644853088:function:alambda_simple", []string{"Region us-west-2 != ap-southeast-1"}},
+		{"arn:aws-cn:lambda:cn-north-1:812644853088:function:alambda_simple", []string{
+			"Partition aws-cn != aws",
+			"Region cn-north-1 != ap-southeast-1",
+		}},
+		{"arn:aws:lambda:ap-southeast-1:812644853088:layer:alambda_simple", []string{
+			"arn:aws:lambda:ap-southeast-1:812644853088:layer:alambda_simple is not a lambda function",
+		}},
+		{"arn:aws:lambda:ap-southeast-1", []string{
+			"invalid ARN arn:aws:lambda:ap-southeast-1: arn: not enough sections",
+		}},
+	}
+	for _, tt := range tests {
+		_, problems := validateFunctionARN(tt.arn, cluster, "alambda_simple")
+		if !reflect.DeepEqual(problems, tt.problems) {
+			t.Errorf("validateFunctionARN(%q) = %q, want %q", tt.arn, problems, tt.problems)
+		}
+	}
+}
+
+func TestLambdaArnCandidates(t *testing.T) {
+	source := `BEGIN
+	CALL mysql.lambda_async('arn:aws:lambda:ap-southeast-1:812644853088:function:alambda_simple',
+		CONCAT('{ "notification_type": "', notification_type, '"}'));
+	CALL mysql.lambda_async("arn:aws:lambda:ap-southeast-1:812644853088:function:other", '{}');
+END`
+	got := lambdaArnCandidateExp.FindAllString(source, -1)
+	want := []string{
+		"arn:aws:lambda:ap-southeast-1:812644853088:function:alambda_simple",
+		"arn:aws:lambda:ap-southeast-1:812644853088:function:other",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("candidates = %q, want %q", got, want)
+	}
+}
+
+func TestStubFunctions(t *testing.T) {
+	f, err := ioutil.TempFile("", "lambda-stub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(`["arn:aws:lambda:ap-southeast-1:812644853088:function:alambda_simple"]`)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("DBCHECK_LAMBDA_STUB", f.Name())
+	defer os.Unsetenv("DBCHECK_LAMBDA_STUB")
+	finder, err := newFunctionFinder(aws.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := finder.(stubFunctions); !ok {
+		t.Fatalf("newFunctionFinder = %T, want stubFunctions", finder)
+	}
+	for s, want := range map[string]bool{
+		"arn:aws:lambda:ap-southeast-1:812644853088:function:alambda_simple": true,
+		"arn:aws:lambda:ap-southeast-1:812644853088:function:other":          false,
+	} {
+		fn, err := arn.Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		exists, err := finder.exists(context.Background(), fn)
+		if err != nil || exists != want {
+			t.Errorf("exists(%s) = %v, %v, want %v", s, exists, err, want)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/apex/log"
+)
+
+// lint runs every registered check once, prints a report and returns the
+// process exit code
+func lint(args []string) int {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	failOn := fs.String("fail-on", "warning", "exit non-zero on findings at or above this severity (info, warning, critical)")
+	fromSnapshots := fs.Bool("snapshot", false, "lint the snapshot bundles named as arguments instead of live targets")
+	fs.Parse(args)
+
+	threshold, err := parseSeverity(*failOn)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	var f fleet
+	if *fromSnapshots {
+		f, err = loadBundles(fs.Args())
+	} else {
+		f, err = newFleet()
+	}
+	if err == nil && len(f) == 0 {
+		err = fmt.Errorf("no targets")
+	}
+	if err != nil {
+		log.WithError(err).Error("error setting configuration")
+		return 2
+	}
+	defer f.Close()
+
+	var findings []Finding
+	for _, h := range f {
+		findings = append(findings, h.runChecks(context.Background())...)
+	}
+	printFindings(os.Stdout, findings)
+
+	for _, f := range findings {
+		if f.Severity >= threshold {
+			return 1
+		}
+	}
+	return 0
+}
+
+func printFindings(out io.Writer, findings []Finding) {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "SEVERITY\tACCOUNT\tCLUSTER\tCHECK\tSUBJECT\tMESSAGE")
+	for _, f := range findings {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", f.Severity, f.Account, f.Cluster, f.Check, f.Subject, f.Message)
+	}
+	w.Flush()
+	fmt.Fprintf(out, "%d findings\n", len(findings))
+}
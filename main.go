@@ -7,18 +7,16 @@ import (
 	"html/template"
 	"net/http"
 	"os"
-	"regexp"
-	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/aws/arn"
-	"github.com/aws/aws-sdk-go-v2/aws/endpoints"
 	"github.com/aws/aws-sdk-go-v2/aws/external"
-	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/aws/stscreds"
 	"github.com/aws/aws-sdk-go-v2/service/rds"
 	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/gorilla/mux"
 	"github.com/jmoiron/sqlx"
 	"github.com/prometheus/client_golang/prometheus"
@@ -30,7 +28,6 @@ import (
 	jsonhandler "github.com/apex/log/handlers/json"
 	texthandler "github.com/apex/log/handlers/text"
 
-	"github.com/go-sql-driver/mysql"
 	_ "github.com/go-sql-driver/mysql"
 )
 
@@ -40,8 +37,6 @@ var (
 	commit  = "none"
 )
 
-var myExp = regexp.MustCompile(`(?m)arn:aws:lambda:ap-southeast-1:(?P<account>\d+):function:(?P<fn>\w+)`)
-
 type CreateProcedure struct {
 	Database            string
 	Procedure           string         `db:"Procedure"`
@@ -51,18 +46,11 @@ type CreateProcedure struct {
 	CollationConnection string         `db:"collation_connection"`
 	DatabaseCollation   string         `db:"Database Collation"`
 	AccountCheck        template.HTML
+	LambdaProblems      []string
+	Functions           []string
 	CorrectCollation    bool
 }
 
-type TableInfo struct {
-	Field   string         `db:"Field"`
-	Type    string         `db:"Type"`
-	Null    sql.NullString `db:"Null"`
-	Key     string         `db:"Key"`
-	Default sql.NullString `db:"Default"`
-	Extra   string         `db:"Extra"`
-}
-
 type Procedures struct {
 	Database            string    `db:"Db"`
 	Name                string    `db:"Name"`
@@ -83,15 +71,44 @@ type dbinfo struct {
 	Params  []rds.Parameter
 }
 
+// latestInfo is the most recent description of the cluster, shared by every
+// copy of a handler so a refresh is seen by the collector and endpoints alike
+type latestInfo struct {
+	mu   sync.RWMutex
+	info dbinfo
+}
+
+func (l *latestInfo) get() dbinfo {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.info
+}
+
+func (l *latestInfo) set(info dbinfo) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.info = info
+}
+
 type handler struct {
+	Name           string
 	AWSCfg         aws.Config
 	DSN            string
 	APIAccessToken string
 	LambdaInvoker  string
 	mysqlhost      string
 	AccountID      string
+	Cluster        string
+	clusterID      string
+	policy         policy
+	uptimes        *uptimeTracker
+	rowCounts      *rowCounter
+	functions      functionFinder
+	recorder       *probeRecorder
+	history        *historyStore
+	notifications  *notifyQueue
 	db             *sqlx.DB
-	dbInfo         dbinfo
+	dbInfo         *latestInfo
 }
 
 func init() {
@@ -106,114 +123,154 @@ func init() {
 
 }
 
-// New setups the configuration assuming various parameters have been setup in the AWS account
-func New() (h handler, err error) {
+// New setups the configuration for a target assuming various parameters have been setup in its AWS account
+func New(t target) (h handler, err error) {
 
-	cfg, err := external.LoadDefaultAWSConfig(external.WithSharedConfigProfile("uneet-prod"))
+	var configs []external.Config
+	if t.Profile != "" {
+		configs = append(configs, external.WithSharedConfigProfile(t.Profile))
+	}
+	cfg, err := external.LoadDefaultAWSConfig(configs...)
 	if err != nil {
-		log.WithError(err).Fatal("setting up credentials")
-		return
+		return h, fmt.Errorf("setting up credentials: %w", err)
+	}
+	cfg.Region = t.Region
+	if t.RoleARN != "" {
+		cfg.Credentials = stscreds.NewAssumeRoleProvider(sts.New(cfg), t.RoleARN)
 	}
-	cfg.Region = endpoints.ApSoutheast1RegionID
 	e, err := env.New(cfg)
 	if err != nil {
 		log.WithError(err).Warn("error getting unee-t env")
 	}
+	p, err := loadPolicy(t)
+	if err != nil {
+		return h, fmt.Errorf("error loading policy: %w", err)
+	}
+	functions, err := newFunctionFinder(cfg)
+	if err != nil {
+		return h, fmt.Errorf("error loading lambda stub: %w", err)
+	}
 
 	h = handler{
 		AWSCfg:         cfg,
 		AccountID:      e.AccountID,
 		LambdaInvoker:  e.GetSecret("LAMBDA_INVOKER_USERNAME"),
-		mysqlhost:      e.Udomain("auroradb"),
+		mysqlhost:      t.Host,
+		clusterID:      t.Cluster,
+		policy:         p,
+		uptimes:        newUptimeTracker(),
+		rowCounts:      newRowCounter(),
+		functions:      functions,
+		dbInfo:         &latestInfo{},
 		APIAccessToken: e.GetSecret("API_ACCESS_TOKEN"),
 	}
+	if h.mysqlhost == "" && h.clusterID == "" {
+		h.mysqlhost = e.Udomain("auroradb")
+	}
 
-	h.DSN = fmt.Sprintf("%s:%s@tcp(%s:3306)/bugzilla?parseTime=true&multiStatements=true&sql_mode=TRADITIONAL&collation=utf8mb4_unicode_520_ci",
-		"root",
-		e.GetSecret("MYSQL_ROOT_PASSWORD"),
-		h.mysqlhost)
-
-	h.db, err = sqlx.Open("mysql", h.DSN)
+	info, err := h.describeCluster(context.Background())
 	if err != nil {
-		log.WithError(err).Fatal("error opening database")
-		return
+		return h, fmt.Errorf("error collecting info: %w", err)
+	}
+	h.dbInfo.set(info)
+	h.Cluster = *info.Cluster.DBClusterIdentifier
+	// later refreshes describe the cluster directly rather than via Route53
+	h.clusterID = h.Cluster
+	h.Name = t.Name
+	if h.Name == "" {
+		h.Name = h.Cluster
 	}
-	h.dbInfo, err = h.describeCluster()
+	if h.mysqlhost == "" {
+		h.mysqlhost = *info.Cluster.Endpoint
+	}
+
+	if t.DSNSecret != "" {
+		h.DSN = e.GetSecret(t.DSNSecret)
+	} else {
+		h.DSN = fmt.Sprintf("%s:%s@tcp(%s:3306)/bugzilla?parseTime=true&multiStatements=true&sql_mode=TRADITIONAL&collation=utf8mb4_unicode_520_ci",
+			"root",
+			e.GetSecret("MYSQL_ROOT_PASSWORD"),
+			h.mysqlhost)
+	}
+
+	h.db, err = sqlx.Open("mysql", h.DSN)
 	if err != nil {
-		log.WithError(err).Fatal("error collecting info")
-		return
+		return h, fmt.Errorf("error opening database: %w", err)
 	}
 
 	return
 
 }
 
-func (h handler) BasicEngine() http.Handler {
+func (f fleet) BasicEngine() http.Handler {
 	app := mux.NewRouter()
-	app.HandleFunc("/", h.ping).Methods("GET")
-	app.HandleFunc("/call", h.call).Methods("GET")
-	app.HandleFunc("/checks", h.checks).Methods("GET")
-	app.HandleFunc("/unicode", h.unicode).Methods("GET")
-	app.HandleFunc("/tables", h.tables).Methods("GET")
-	app.HandleFunc("/describe", func(w http.ResponseWriter, r *http.Request) { response.JSON(w, h.dbInfo) }).Methods("GET")
+	app.HandleFunc("/", f.route(handler.ping)).Methods("GET")
+	app.HandleFunc("/call", f.route(handler.call)).Methods("GET")
+	app.HandleFunc("/roundtrips", f.route(handler.roundTripHistory)).Methods("GET")
+	app.HandleFunc("/history", f.route(handler.showHistory)).Methods("GET")
+	app.HandleFunc("/checks", f.route(handler.checks)).Methods("GET")
+	app.HandleFunc("/unicode", f.route(handler.unicode)).Methods("GET")
+	app.HandleFunc("/tables", f.route(handler.tables)).Methods("GET")
+	app.HandleFunc("/procedures", f.route(handler.procedureFingerprints)).Methods("GET")
+	app.HandleFunc("/lambda", f.route(handler.lambda)).Methods("GET")
+	app.HandleFunc("/remediate", f.route(handler.remediate)).Methods("GET")
+	app.HandleFunc("/findings", f.findings).Methods("GET")
+	app.HandleFunc("/describe", f.route(func(h handler, w http.ResponseWriter, r *http.Request) { response.JSON(w, h.dbInfo.get()) })).Methods("GET")
 	app.Handle("/metrics", promhttp.Handler()).Methods("GET")
 	log.Infof("STAGE: %s", os.Getenv("UP_STAGE"))
 
 	if os.Getenv("UP_STAGE") == "" {
 		// local dev, get around permissions
+		app.HandleFunc("/ack", f.ack).Methods("GET", "POST")
 		return app
 	}
 
-	return env.Protect(app, h.APIAccessToken)
+	// the invoked function acknowledges with the token sent in its payload
+	// rather than the API token
+	root := mux.NewRouter()
+	root.HandleFunc("/ack", f.ack).Methods("GET", "POST")
+	root.PathPrefix("/").Handler(env.Protect(app, f[0].APIAccessToken))
+	return root
 
 }
 
 func main() {
 
-	h, err := New()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "lint":
+			os.Exit(lint(os.Args[2:]))
+		case "schema":
+			os.Exit(dumpSchema(os.Args[2:]))
+		case "procedures":
+			os.Exit(dumpFingerprints(os.Args[2:]))
+		case "remediate":
+			os.Exit(remediate(os.Args[2:]))
+		case "snapshot":
+			os.Exit(snapshot(os.Args[2:]))
+		default:
+			log.Fatalf("unknown command %q", os.Args[1])
+		}
+	}
+
+	f, err := newFleet()
 	if err != nil {
 		log.WithError(err).Fatal("error setting configuration")
 		return
 	}
-	defer h.db.Close()
+	defer f.Close()
+	f.keepHistory()
 
-	dbcheck := prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "dbinfo",
-			Help: "A metric with a constant '1' value labeled by the Unee-T schema version, Aurora version and lambda commit.",
-		},
-		[]string{"schemaversion",
-			"auroraversion",
-			"commit",
-			"engineversion",
-			"instanceclass",
-			"endpoint",
-			"innodb_file_format",
-			"status"},
-	)
-
-	dbcheck.WithLabelValues(h.schemaversion(),
-		h.aversion(),
-		commit,
-		h.engineVersion(),
-		h.instanceClass(),
-		*h.dbInfo.Cluster.Endpoint,
-		h.innodbFileFormat(),
-		// https://docs.aws.amazon.com/AmazonRDS/latest/UserGuide/Overview.DBInstance.Status.html
-		*h.dbInfo.Cluster.Status).Set(1)
-
-	// TODO: Implement a collector
-	// i.e. I am using the "direct instrumentation" approach atm
-	// https://github.com/prometheus/docs/blob/master/content/docs/instrumenting/writing_exporters.md#collectors
-	// but it's lambda, so can we assume it goes cold ??
-	prometheus.MustRegister(dbcheck)
-	// prometheus.MustRegister(h.userGroupMapCount())
-	prometheus.MustRegister(h.slowLogEnabled())
-	prometheus.MustRegister(h.iamEnabled())
-	prometheus.MustRegister(h.insync())
+	for _, h := range f {
+		prometheus.MustRegister(newCollector(h))
+	}
+	for _, h := range f {
+		go h.watchRowCounts(context.Background())
+		go h.watchRoundTrips(context.Background())
+	}
 
 	addr := ":" + os.Getenv("PORT")
-	app := h.BasicEngine()
+	app := f.BasicEngine()
 
 	if err := http.ListenAndServe(addr, app); err != nil {
 		log.WithError(err).Fatal("error listening")
@@ -222,103 +279,37 @@ func main() {
 }
 
 func (h handler) tables(w http.ResponseWriter, r *http.Request) {
-	var tables []string
-	err := h.db.Select(&tables, `show tables`)
+	keys, err := h.autoIncrements()
 	if err != nil {
-		log.WithError(err).Errorf("failed to show tables")
+		log.WithError(err).Error("failed to get auto_increment headroom")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-
-	smallint := make(map[string]int)
-
-	for _, t := range tables {
-		var tinfo []TableInfo
-		err := h.db.Select(&tinfo, fmt.Sprintf("describe %s", t))
-		if err != nil {
-			log.WithError(err).WithField("table", t).Errorf("failed to describe table")
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		if strings.Contains(tinfo[0].Type, "smallint") {
-			var count int
-			err := h.db.Get(&count, fmt.Sprintf("select COUNT(*) from %s", t))
-			if err != nil {
-				log.WithError(err).WithField("table", t).Errorf("failed to count table")
-			}
-			smallint[t] = count
-		}
-	}
-
-	// https://stackoverflow.com/a/44380276/4534
-
-	type kv struct {
-		Key   string
-		Value int
-	}
-
-	var ss []kv
-	for k, v := range smallint {
-		ss = append(ss, kv{k, v})
-	}
-
-	sort.Slice(ss, func(i, j int) bool {
-		return ss[i].Value > ss[j].Value
-	})
-
-	response.OK(w, ss)
+	response.OK(w, keys)
 }
 
 func (h handler) unicode(w http.ResponseWriter, r *http.Request) {
+	dbinfo, err := h.databaseCollations()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-	type tableStatus struct {
-		Name          string         `db:"Name"`
-		Engine        sql.NullString `db:"Engine"`
-		Version       sql.NullString `db:"Version"`
-		RowFormat     sql.NullString `db:"Row_format"`
-		Rows          sql.NullString `db:"Rows"`
-		AvgRowLength  sql.NullString `db:"Avg_row_length"`
-		DataLength    sql.NullString `db:"Data_length"`
-		MaxDataLength sql.NullString `db:"Max_data_length"`
-		IndexLength   sql.NullString `db:"Index_length"`
-		DataFree      sql.NullString `db:"Data_free"`
-		AutoIncrement sql.NullInt64  `db:"Auto_increment"`
-		CreateTime    mysql.NullTime `db:"Create_time"`
-		UpdateTime    mysql.NullTime `db:"Update_time"`
-		CheckTime     mysql.NullTime `db:"Check_time"`
-		Checksum      sql.NullString `db:"Checksum"`
-		CreateOptions sql.NullString `db:"Create_options"`
-		Comment       sql.NullString `db:"Comment"`
-		Collation     sql.NullString `db:"Collation"`
-	}
-
-	type showCreate struct {
-		Database       string `db:"Database"`
-		CreateDatabase string `db:"Create Database"`
-	}
-	type dbunicode struct {
-		Name   string
-		Info   []showCreate
-		Tables []tableStatus
-	}
-	dbinfo := []dbunicode{{Name: "bugzilla"}, {Name: "unee_t_enterprise"}}
-
-	for j := 0; j < len(dbinfo); j++ {
-		h.db.MustExec(fmt.Sprintf("use %s", dbinfo[j].Name))
-		err := h.db.Select(&dbinfo[j].Info, fmt.Sprintf("SHOW CREATE DATABASE %s;", dbinfo[j].Name))
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+	if wantsJSON(r) {
+		report := unicodeReport{
+			Findings:  append([]Finding{}, h.label(unicodeCheck{h}.findings(dbinfo))...),
+			Databases: []databaseReport{},
 		}
-
-		err = h.db.Select(&dbinfo[j].Tables, `SHOW TABLE STATUS;`)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+		for _, db := range dbinfo {
+			report.Databases = append(report.Databases, newDatabaseReport(db, h.policy.Collation))
 		}
+		response.JSON(w, report)
+		return
 	}
 
-	var t = template.Must(template.New("").Parse(`<!DOCTYPE html>
+	var t = template.Must(template.New("").Funcs(template.FuncMap{
+		"collation": func() string { return h.policy.Collation },
+	}).Parse(`<!DOCTYPE html>
 <html lang=en>
 <head>
 <meta charset="utf-8">
@@ -338,7 +329,7 @@ body { padding: 1rem; font-family: "Open Sans", "Segoe UI", "Seravek", sans-seri
 {{ if .Collation.Valid }}
 <li>{{ .Name }} - 
 
-{{ if eq .Collation.String "utf8mb4_unicode_520_ci" }}
+{{ if eq .Collation.String collation }}
 {{ .Collation.String }}
 {{ else }}
 <span style="color:red">{{ .Collation.String }}</span>
@@ -352,7 +343,7 @@ body { padding: 1rem; font-family: "Open Sans", "Segoe UI", "Seravek", sans-seri
 </ol>
 {{- end }}
 </body></html>`))
-	err := t.Execute(w, dbinfo)
+	err = t.Execute(w, dbinfo)
 	if err != nil {
 		log.WithError(err).Error("template failed")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -361,134 +352,38 @@ body { padding: 1rem; font-family: "Open Sans", "Segoe UI", "Seravek", sans-seri
 }
 
 func (h handler) checks(w http.ResponseWriter, r *http.Request) {
-
-	if h.LambdaInvoker == "" {
-		http.Error(w, "LAMBDA_INVOKER_USERNAME is unset", http.StatusInternalServerError)
-		return
-	}
-
-	var invokerExists bool
-	err := h.db.Get(&invokerExists, `SELECT EXISTS(SELECT 1 FROM mysql.user WHERE user = ?)`, h.LambdaInvoker)
-	if err != nil {
-		log.WithError(err).Errorf("failed to select %s", h.LambdaInvoker)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	if !invokerExists {
-		http.Error(w, fmt.Sprintf("LAMBDA_INVOKER_USERNAME: %s does not exist", h.LambdaInvoker), http.StatusInternalServerError)
-		return
-	}
-
-	var grants []string
-	err = h.db.Select(&grants, fmt.Sprintf("show grants for %s", h.LambdaInvoker))
-	if err != nil {
-		log.WithError(err).Errorf("failed to get grants for %s", h.LambdaInvoker)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	log.Infof("Grants: %#v", grants)
-	var executePerms bool
-	for _, v := range grants {
-		log.Infof("Checking: %q", v)
-		if v == fmt.Sprintf("GRANT EXECUTE ON *.* TO '%s'@'%%'", h.LambdaInvoker) {
-			executePerms = true
-			break
+	findings := []Finding{}
+	for _, c := range []Check{lambdaInvokerCheck{h}, lambdaAccessCheck{h}} {
+		ff, err := c.Run(r.Context())
+		if err != nil {
+			log.WithError(err).WithField("check", c.ID()).Error("check failed")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
-	}
-	if !executePerms {
-		http.Error(w, fmt.Sprintf("LAMBDA_INVOKER_USERNAME: %s does not have execute permissions", h.LambdaInvoker), http.StatusInternalServerError)
-		return
-	}
-
-	var lambdaAccess bool
-	for _, v := range h.dbInfo.Cluster.AssociatedRoles {
-		log.WithField("status", v.Status).Infof("Role: %#v", v)
-		if *v.Status == "ACTIVE" {
-			a, err := arn.Parse(*v.RoleArn)
-			if err != nil {
-				log.WithError(err).Errorf("failed to get arn for %s", *v.RoleArn)
-				continue
-			}
-			log.Infof("Checking RoleArn: %s has lambda perms", a.Resource)
-			i := iam.New(h.AWSCfg)
-			// https://godoc.org/github.com/aws/aws-sdk-go-v2/service/iam#IAM.ListAttachedRolePoliciesRequest
-			req := i.ListAttachedRolePoliciesRequest(&iam.ListAttachedRolePoliciesInput{
-				RoleName: aws.String(strings.TrimPrefix(a.Resource, "role/")),
-			})
-			// aws --profile uneet-prod iam list-attached-role-policies --role-name Aurora_access_to_lambda
-			resp, err := req.Send(context.TODO())
-			if err != nil {
-				log.WithError(err).Error("failed to get policies")
-				return
-			}
-			log.Infof("list-attached-role-policies: %#v", resp)
-			for _, v := range resp.AttachedPolicies {
-				log.Infof("Policy: %#v", v)
-				if *v.PolicyArn == "arn:aws:iam::aws:policy/AWSLambdaFullAccess" {
-					lambdaAccess = true
-					break
-				}
-			}
-		} else {
-			log.Warnf("%#v not ACTIVE", v)
+		if len(ff) > 0 && !wantsJSON(r) {
+			http.Error(w, ff[0].Message, http.StatusInternalServerError)
+			return
 		}
+		findings = append(findings, ff...)
 	}
 
-	if !lambdaAccess {
-		http.Error(w, "Active Cluster.AssociatedRoles is missing the AWSLambdaFullAccess policy", http.StatusInternalServerError)
-		return
-	}
-
-	pp := []Procedures{}
-	err = h.db.Select(&pp, `SHOW PROCEDURE STATUS`)
+	procsInfo, err := h.procedures()
 	if err != nil {
-		log.WithError(err).Error("failed to make SHOW PROCEDURE STATUS listing")
+		log.WithError(err).Error("failed to get procedures")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	// log.Infof("Results: %#v", pp)
-	var procsInfo []CreateProcedure
-	for _, v := range pp {
-		if v.Database == "sys" {
-			continue
-		}
-		if v.Database == "mysql" {
-			continue
-		}
 
-		var src CreateProcedure
-		// There must be an easier way
-		log.Debugf("Switching to: %s", v.Database)
-		h.db.MustExec(fmt.Sprintf("use %s", v.Database))
-		src.Database = v.Database
-		err := h.db.QueryRow(fmt.Sprintf("SHOW CREATE PROCEDURE %s", v.Name)).Scan(&src.Procedure, &src.SqlMode, &src.Source, &src.CharacterSetClient, &src.CollationConnection, &src.DatabaseCollation)
-		if err != nil {
-			log.WithError(err).WithField("name", v.Name).Error("failed to get procedure source")
-			continue
-		}
-
-		if strings.HasPrefix(v.Name, "lambda") {
-			result := findNamedMatches(myExp, src.Source.String)
-			// log.Infof("account: %s fn: %s\n", result["account"], result["fn"])
-			// log.WithField("name", v.Name).Infof("src: %#v", &src.Source)
-			output := fmt.Sprintf("Fn: %s Account: %s", result["fn"], result["account"])
-			if result["fn"] == "alambda_simple" {
-				if result["account"] != h.AccountID {
-					output += fmt.Sprintf("<span style='color: red;'>Account ID %s != %s</span>\n", result["account"], h.AccountID)
-				}
-			} else {
-				output += fmt.Sprintf("<span style='color: red;'>Function %s != %s</span>\n", result["fn"], "alambda_simple")
-			}
-			src.AccountCheck = template.HTML(output)
+	if wantsJSON(r) {
+		report := checksReport{
+			Findings:   h.label(append(findings, procedureCheck{h}.findings(procsInfo)...)),
+			Procedures: []procedureReport{},
 		}
-
-		if src.DatabaseCollation == "utf8mb4_unicode_520_ci" && src.CharacterSetClient == "utf8mb4" {
-			src.CorrectCollation = true
+		for _, v := range procsInfo {
+			report.Procedures = append(report.Procedures, newProcedureReport(v))
 		}
-
-		procsInfo = append(procsInfo, src)
-
+		response.JSON(w, report)
+		return
 	}
 
 	rejig := map[string][]CreateProcedure{}
@@ -498,6 +393,8 @@ func (h handler) checks(w http.ResponseWriter, r *http.Request) {
 
 	// log.Infof("%#v", procsInfo)
 	var t = template.Must(template.New("").Funcs(template.FuncMap{
+		"collation":    func() string { return h.policy.Collation },
+		"characterSet": func() string { return h.policy.CharacterSet },
 		"IncorrectCount": func(procs []CreateProcedure) (wrong int) {
 			for _, v := range procs {
 				if !v.CorrectCollation {
@@ -536,13 +433,13 @@ pre:hover {
 <li>
 <h4>Procedure: {{ .Procedure }}</h4>
 
-{{- if eq .DatabaseCollation "utf8mb4_unicode_520_ci" }}
+{{- if eq .DatabaseCollation collation }}
 <span>DatabaseCollation: {{ .DatabaseCollation }}</span>
 {{ else }}
 <span style="color: red">DatabaseCollation: {{ .DatabaseCollation }}</span>
 {{ end }}
 
-{{- if eq .CharacterSetClient "utf8mb4"  }}
+{{- if eq .CharacterSetClient characterSet }}
 <span>CharacterSetClient: {{ .CharacterSetClient }}</span>
 {{ else }}
 <span style="color: red">CharacterSetClient: {{ .CharacterSetClient }}</span>
@@ -566,15 +463,12 @@ pre:hover {
 	}
 }
 
-func (h handler) call(w http.ResponseWriter, r *http.Request) {
-	_, err := h.db.Query(fmt.Sprintf(`CALL mysql.lambda_async( 'arn:aws:lambda:ap-southeast-1:%s:function:alambda_simple', '{ "heartbeat": "%s"}' )`,
-		h.AccountID, time.Now()))
-	if err != nil {
-		log.WithError(err).Error("failed to make mysql.lambda_async call")
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+func (f fleet) findings(w http.ResponseWriter, r *http.Request) {
+	findings := []Finding{}
+	for _, h := range f {
+		findings = append(findings, h.runChecks(r.Context())...)
 	}
-	fmt.Fprintf(w, "OK")
+	response.JSON(w, findings)
 }
 
 func (h handler) ping(w http.ResponseWriter, r *http.Request) {
@@ -592,7 +486,9 @@ func (h handler) ping(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h handler) innodbFileFormat() (format string) {
-	err := h.db.Get(&format, "SELECT @@innodb_file_format")
+	err := h.probe("innodb_file_format", &format, func() error {
+		return h.db.Get(&format, "SELECT @@innodb_file_format")
+	})
 	if err != nil {
 		log.WithError(err).Error("failed to get innodb_file_format version")
 		return
@@ -601,7 +497,9 @@ func (h handler) innodbFileFormat() (format string) {
 }
 
 func (h handler) schemaversion() (version string) {
-	err := h.db.Get(&version, "SET @highest_id = (SELECT MAX(`id`) FROM `ut_db_schema_version`); SELECT `schema_version` FROM `ut_db_schema_version` WHERE `id` = @highest_id;")
+	err := h.probe("schema_version", &version, func() error {
+		return h.db.Get(&version, "SET @highest_id = (SELECT MAX(`id`) FROM `bugzilla`.`ut_db_schema_version`); SELECT `schema_version` FROM `bugzilla`.`ut_db_schema_version` WHERE `id` = @highest_id;")
+	})
 	if err != nil {
 		log.WithError(err).Error("failed to get unee-t version")
 		return
@@ -610,7 +508,9 @@ func (h handler) schemaversion() (version string) {
 }
 
 func (h handler) aversion() (aversion string) {
-	err := h.db.Get(&aversion, "select AURORA_VERSION()")
+	err := h.probe("aurora_version", &aversion, func() error {
+		return h.db.Get(&aversion, "select AURORA_VERSION()")
+	})
 	if err != nil {
 		log.WithError(err).Error("failed to get AWS Aurora version")
 		return
@@ -618,21 +518,8 @@ func (h handler) aversion() (aversion string) {
 	return aversion
 }
 
-func (h handler) userGroupMapCount() (countMetric prometheus.Gauge) {
-	var count float64
-	err := h.db.Get(&count, "select COUNT(*) from user_group_map")
-	if err != nil {
-		log.WithError(err).Error("failed to get count")
-		return
-	}
-	log.Infof("Count: %f", count)
-	countMetric = prometheus.NewGauge(prometheus.GaugeOpts{Name: "user_group_map_total", Help: "shows the number of rows in the user_group_map table."})
-	countMetric.Set(count)
-	return countMetric
-}
-
 func (h handler) instanceClass() string {
-	for _, db := range h.dbInfo.DBs {
+	for _, db := range h.dbInfo.get().DBs {
 		if *db.DBInstanceClass != "" {
 			return *db.DBInstanceClass
 		}
@@ -641,7 +528,7 @@ func (h handler) instanceClass() string {
 }
 
 func (h handler) engineVersion() string {
-	for _, db := range h.dbInfo.DBs {
+	for _, db := range h.dbInfo.get().DBs {
 		if *db.EngineVersion != "" {
 			return *db.EngineVersion
 		}
@@ -649,78 +536,6 @@ func (h handler) engineVersion() string {
 	return ""
 }
 
-func (h handler) insync() (countMetric prometheus.Gauge) {
-	countMetric = prometheus.NewGauge(prometheus.GaugeOpts{Name: "insync", Help: "shows whether we are in-sync with the parameter groups"})
-	for _, db := range h.dbInfo.Cluster.DBClusterMembers {
-		if *db.DBClusterParameterGroupStatus != "in-sync" {
-			log.WithFields(log.Fields{
-				"db": db.DBInstanceIdentifier,
-			}).Warn("not in-sync")
-			return countMetric
-		}
-	}
-
-	for _, db := range h.dbInfo.DBs {
-		for _, groups := range db.DBParameterGroups {
-			if *groups.ParameterApplyStatus != "in-sync" {
-				log.WithFields(log.Fields{
-					"db":         db.DBInstanceIdentifier,
-					"paramgroup": groups.DBParameterGroupName,
-				}).Warn("not in-sync")
-				return countMetric
-			}
-		}
-	}
-	countMetric.Set(1)
-	return countMetric
-}
-
-func (h handler) iamEnabled() (countMetric prometheus.Gauge) {
-	countMetric = prometheus.NewGauge(prometheus.GaugeOpts{Name: "iam", Help: "shows whether IAM auth is enabled or not."})
-	for _, db := range h.dbInfo.DBs {
-		if *db.IAMDatabaseAuthenticationEnabled {
-			log.WithField("endpoint", db.Endpoint.Address).Info("IAM ENABLED")
-			countMetric.Set(1)
-		} else {
-			log.WithField("endpoint", db.Endpoint.Address).Warn("IAM NOT enabled")
-		}
-	}
-	return countMetric
-}
-
-func (h handler) slowLogEnabled() *prometheus.GaugeVec {
-	slowcheck := prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "slowlog",
-			Help: "A metric with a constant '1' value labeled with slow log lint.",
-		},
-		[]string{
-			"enabled",
-			"log_output",
-			"log_queries_not_using_indexes"},
-	)
-
-	slowcheck.WithLabelValues(
-		h.lookup("slow_query_log"),
-		h.lookup("log_output"),
-		h.lookup("log_queries_not_using_indexes"),
-	).Set(1)
-
-	return slowcheck
-}
-
-func (h handler) lookup(key string) string {
-	for _, v := range h.dbInfo.Params {
-		if *v.ParameterName == key {
-			log.Infof("Looking up key: %s", key)
-			if v.ParameterValue != nil {
-				return *v.ParameterValue
-			}
-		}
-	}
-	return ""
-}
-
 func (h handler) lookupHostedZone() (string, error) {
 	// https://godoc.org/github.com/aws/aws-sdk-go-v2/service/route53#example-Route53-GetHostedZoneRequest-Shared00
 	r53 := route53.New(h.AWSCfg)
@@ -764,79 +579,81 @@ func (h handler) lookupClusterName() (string, error) {
 	return "", fmt.Errorf("no alias found for %s", h.mysqlhost)
 }
 
-func (h handler) describeCluster() (dbInfo dbinfo, err error) {
-	dnsEndpoint, err := h.lookupClusterName()
-	if err != nil {
-		return dbInfo, err
-	}
-	rdsapi := rds.New(h.AWSCfg)
-	req := rdsapi.DescribeDBClustersRequest(&rds.DescribeDBClustersInput{})
-	result, err := req.Send(context.TODO())
-	if err != nil {
-		return dbInfo, err
-	}
-	for _, v := range result.DBClusters {
-		if *v.Endpoint == dnsEndpoint {
-			dbInfo.Cluster = v
-			// https://godoc.org/github.com/aws/aws-sdk-go-v2/service/rds#example-RDS-DescribeDBInstancesRequest-Shared00
-
-			req := rdsapi.DescribeDBClusterParametersRequest(&rds.DescribeDBClusterParametersInput{DBClusterParameterGroupName: aws.String(*v.DBClusterParameterGroup),
-				Source: aws.String("user"),
-			})
-			result, err := req.Send(context.TODO())
+func (h handler) describeCluster(ctx context.Context) (dbInfo dbinfo, err error) {
+	err = h.probe("describe_cluster", &dbInfo, func() error {
+		input := &rds.DescribeDBClustersInput{}
+		var dnsEndpoint string
+		if h.clusterID != "" {
+			input.DBClusterIdentifier = aws.String(h.clusterID)
+		} else {
+			dnsEndpoint, err = h.lookupClusterName()
 			if err != nil {
-				return dbInfo, err
+				return err
 			}
-			log.WithField("DBClusterParameterGroup", *v.DBClusterParameterGroup).Info("recording cluster")
-
-			dbInfo.Params = append(dbInfo.Params, result.Parameters...)
-			log.Infof("cluster: %#v", dbInfo.Params)
-
-			log.WithField("number of dbs", len(v.DBClusterMembers)).Info("describing instances")
-			for _, db := range v.DBClusterMembers {
-				req := rdsapi.DescribeDBInstancesRequest(&rds.DescribeDBInstancesInput{DBInstanceIdentifier: aws.String(*db.DBInstanceIdentifier)})
-				result, err := req.Send(context.TODO())
+		}
+		rdsapi := rds.New(h.AWSCfg)
+		req := rdsapi.DescribeDBClustersRequest(input)
+		result, err := req.Send(ctx)
+		if err != nil {
+			return err
+		}
+		for _, v := range result.DBClusters {
+			if h.clusterID != "" || *v.Endpoint == dnsEndpoint {
+				dbInfo.Cluster = v
+				// https://godoc.org/github.com/aws/aws-sdk-go-v2/service/rds#example-RDS-DescribeDBInstancesRequest-Shared00
+
+				req := rdsapi.DescribeDBClusterParametersRequest(&rds.DescribeDBClusterParametersInput{DBClusterParameterGroupName: aws.String(*v.DBClusterParameterGroup),
+					Source: aws.String("user"),
+				})
+				result, err := req.Send(ctx)
 				if err != nil {
-					return dbInfo, err
+					return err
 				}
-				dbInfo.DBs = append(dbInfo.DBs, result.DBInstances...)
+				log.WithField("DBClusterParameterGroup", *v.DBClusterParameterGroup).Info("recording cluster")
 
-			}
-			for _, db := range dbInfo.DBs {
-				groupName := db.DBParameterGroups[0].DBParameterGroupName
+				dbInfo.Params = append(dbInfo.Params, result.Parameters...)
+				log.Infof("cluster: %#v", dbInfo.Params)
 
-				for _, group := range db.DBParameterGroups {
-					if groupName != group.DBParameterGroupName {
-						log.Errorf("Differing parameter groups! %q != %q", *groupName, *group.DBParameterGroupName)
-					}
-					log.WithField("groupname", *group.DBParameterGroupName).Info("describing")
-					req := rdsapi.DescribeDBParametersRequest(&rds.DescribeDBParametersInput{
-						DBParameterGroupName: aws.String(*group.DBParameterGroupName),
-						Source:               aws.String("user"),
-					})
-
-					p := rds.NewDescribeDBParametersPaginator(req)
-					for p.Next(context.TODO()) {
-						page := p.CurrentPage()
-						dbInfo.Params = append(dbInfo.Params, page.Parameters...)
-						// log.Infof("Page: %#v", page)
+				log.WithField("number of dbs", len(v.DBClusterMembers)).Info("describing instances")
+				for _, db := range v.DBClusterMembers {
+					req := rdsapi.DescribeDBInstancesRequest(&rds.DescribeDBInstancesInput{DBInstanceIdentifier: aws.String(*db.DBInstanceIdentifier)})
+					result, err := req.Send(ctx)
+					if err != nil {
+						return err
 					}
+					dbInfo.DBs = append(dbInfo.DBs, result.DBInstances...)
 
 				}
-			}
+				for _, db := range dbInfo.DBs {
+					groupName := db.DBParameterGroups[0].DBParameterGroupName
+
+					for _, group := range db.DBParameterGroups {
+						if groupName != group.DBParameterGroupName {
+							log.Errorf("Differing parameter groups! %q != %q", *groupName, *group.DBParameterGroupName)
+						}
+						log.WithField("groupname", *group.DBParameterGroupName).Info("describing")
+						req := rdsapi.DescribeDBParametersRequest(&rds.DescribeDBParametersInput{
+							DBParameterGroupName: aws.String(*group.DBParameterGroupName),
+							Source:               aws.String("user"),
+						})
+
+						p := rds.NewDescribeDBParametersPaginator(req)
+						for p.Next(ctx) {
+							page := p.CurrentPage()
+							dbInfo.Params = append(dbInfo.Params, page.Parameters...)
+							// log.Infof("Page: %#v", page)
+						}
 
-			return dbInfo, err
-		}
-	}
-	return dbInfo, fmt.Errorf("no cluster info found for %s", h.mysqlhost)
-}
-
-func findNamedMatches(regex *regexp.Regexp, str string) map[string]string {
-	match := regex.FindStringSubmatch(str)
+					}
+				}
 
-	results := map[string]string{}
-	for i, name := range match {
-		results[regex.SubexpNames()[i]] = name
-	}
-	return results
+				return err
+			}
+		}
+		if h.clusterID != "" {
+			return fmt.Errorf("no cluster info found for %s", h.clusterID)
+		}
+		return fmt.Errorf("no cluster info found for %s", h.mysqlhost)
+	})
+	return dbInfo, err
 }
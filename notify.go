@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+)
+
+// notifyTimeout bounds each delivery
+const notifyTimeout = 10 * time.Second
+
+var notifyClient = &http.Client{Timeout: notifyTimeout}
+
+// notifier is where changes in findings are delivered
+type notifier struct {
+	// Type is webhook for the changes as JSON, slack for a Slack compatible
+	// incoming webhook or smtp for email
+	Type string `json:"type"`
+	URL  string `json:"url"`
+	// MinSeverity drops changes to less severe findings
+	MinSeverity Severity `json:"min_severity"`
+	// Addr is the host:port of the SMTP server, authenticated as Username
+	// with the password in DBCHECK_SMTP_PASSWORD when it is set
+	Addr     string   `json:"addr"`
+	Username string   `json:"username"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+}
+
+// notification is what a generic webhook receives
+type notification struct {
+	Name    string          `json:"name"`
+	Account string          `json:"account"`
+	Cluster string          `json:"cluster"`
+	Changes []findingChange `json:"changes"`
+}
+
+// severity is the worse of the finding's severity and what it was
+func (c findingChange) severity() Severity {
+	if c.Previous != nil && *c.Previous > c.Finding.Severity {
+		return *c.Previous
+	}
+	return c.Finding.Severity
+}
+
+func (c findingChange) String() string {
+	f := c.Finding
+	subject := f.Check
+	if f.Subject != "" {
+		subject += " " + f.Subject
+	}
+	switch c.Change {
+	case changeSeverity:
+		return fmt.Sprintf("%s is now %s, was %s: %s", subject, f.Severity, *c.Previous, f.Message)
+	case changeResolved:
+		return fmt.Sprintf("%s resolved after %s: %s", subject, f.Resolved.Sub(f.FirstSeen).Round(time.Second), f.Message)
+	}
+	return fmt.Sprintf("%s %s: %s", subject, f.Severity, f.Message)
+}
+
+func (n notification) subject() string {
+	return fmt.Sprintf("dbcheck %s (%s %s): %d changed findings", n.Name, n.Account, n.Cluster, len(n.Changes))
+}
+
+func (n notification) text() string {
+	lines := []string{n.subject()}
+	for _, c := range n.Changes {
+		lines = append(lines, "• "+c.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (n notifier) send(ctx context.Context, msg notification) error {
+	switch n.Type {
+	case "webhook":
+		return postJSON(ctx, n.URL, msg)
+	case "slack":
+		return postJSON(ctx, n.URL, map[string]string{"text": msg.text()})
+	case "smtp":
+		return n.mail(ctx, msg)
+	}
+	return fmt.Errorf("unknown notifier type %q", n.Type)
+}
+
+func postJSON(ctx context.Context, url string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := notifyClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("%s responded %s", url, res.Status)
+	}
+	return nil
+}
+
+// mail sends through the SMTP server like smtp.SendMail, which has no
+// timeout, but gives up at ctx's deadline
+func (n notifier) mail(ctx context.Context, msg notification) error {
+	host, _, err := net.SplitHostPort(n.Addr)
+	if err != nil {
+		return fmt.Errorf("invalid SMTP addr %q: %w", n.Addr, err)
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", n.Addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err = c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if n.Username != "" {
+		if err = c.Auth(smtp.PlainAuth("", n.Username, os.Getenv("DBCHECK_SMTP_PASSWORD"), host)); err != nil {
+			return err
+		}
+	}
+	if err = c.Mail(n.From); err != nil {
+		return err
+	}
+	for _, to := range n.To {
+		if err = c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "From: %s\r\n", n.From)
+	fmt.Fprintf(w, "To: %s\r\n", strings.Join(n.To, ", "))
+	fmt.Fprintf(w, "Subject: %s\r\n", msg.subject())
+	fmt.Fprintf(w, "Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	fmt.Fprint(w, strings.Replace(msg.text(), "\n", "\r\n", -1))
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// notifyQueueSize is how many deliveries may wait before new ones are dropped
+const notifyQueueSize = 100
+
+type delivery struct {
+	notifier     notifier
+	notification notification
+}
+
+// notifyQueue delivers notifications one at a time in the background, so a
+// slow endpoint never holds up an evaluation. On Lambda a container is frozen
+// between requests, stalling anything in the background, so there it has no
+// queue and delivers within the evaluation instead.
+type notifyQueue struct {
+	deliveries chan delivery
+	done       chan struct{}
+	closing    sync.Once
+}
+
+func newNotifyQueue() *notifyQueue {
+	if os.Getenv("UP_STAGE") != "" {
+		return &notifyQueue{}
+	}
+	q := &notifyQueue{
+		deliveries: make(chan delivery, notifyQueueSize),
+		done:       make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+func (q *notifyQueue) run() {
+	defer close(q.done)
+	for d := range q.deliveries {
+		d.deliver()
+	}
+}
+
+func (d delivery) deliver() {
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	err := d.notifier.send(ctx, d.notification)
+	l := log.WithFields(log.Fields{"type": d.notifier.Type, "changes": len(d.notification.Changes)})
+	if err != nil {
+		l.WithError(err).Error("failed to notify")
+		return
+	}
+	l.Info("notified")
+}
+
+func (q *notifyQueue) enqueue(d delivery) {
+	if q.deliveries == nil {
+		d.deliver()
+		return
+	}
+	select {
+	case q.deliveries <- d:
+	default:
+		log.WithField("type", d.notifier.Type).Error("notification queue is full, dropping")
+	}
+}
+
+// close delivers what is queued and stops, it is safe to call more than once
+func (q *notifyQueue) close() {
+	if q.deliveries == nil {
+		return
+	}
+	q.closing.Do(func() { close(q.deliveries) })
+	<-q.done
+}
+
+// canNotify reports whether notifications are deduplicated across every
+// process that evaluates. Each Lambda container has its own memory and /tmp,
+// so unless DBCHECK_HISTORY names storage they share, standing findings would
+// be delivered again on every cold start.
+func canNotify() bool {
+	if os.Getenv("UP_STAGE") == "" {
+		return true
+	}
+	path := os.Getenv("DBCHECK_HISTORY")
+	tmp := filepath.Clean(os.TempDir()) + string(filepath.Separator)
+	return path != "" && !strings.HasPrefix(filepath.Clean(path), tmp)
+}
+
+// notify queues the changes of an evaluation for each of the policy's
+// notifiers, a finding that stands unchanged is never delivered again
+func (h handler) notify(changes []findingChange) {
+	if h.notifications == nil {
+		return
+	}
+	for _, n := range h.policy.Notify {
+		var selected []findingChange
+		for _, c := range changes {
+			if c.severity() >= n.MinSeverity {
+				selected = append(selected, c)
+			}
+		}
+		if len(selected) == 0 {
+			continue
+		}
+		h.notifications.enqueue(delivery{n, notification{
+			Name:    h.Name,
+			Account: h.AccountID,
+			Cluster: h.Cluster,
+			Changes: selected,
+		}})
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCanNotify(t *testing.T) {
+	for _, name := range []string{"UP_STAGE", "DBCHECK_HISTORY"} {
+		if v, ok := os.LookupEnv(name); ok {
+			defer os.Setenv(name, v)
+		} else {
+			defer os.Unsetenv(name)
+		}
+	}
+	tests := []struct {
+		stage, history string
+		want           bool
+	}{
+		{"", "", true},
+		{"production", "", false},
+		{"production", filepath.Join(os.TempDir(), "dbcheck-history.json"), false},
+		{"production", "/mnt/efs/dbcheck-history.json", true},
+	}
+	for _, tt := range tests {
+		os.Setenv("UP_STAGE", tt.stage)
+		os.Setenv("DBCHECK_HISTORY", tt.history)
+		if got := canNotify(); got != tt.want {
+			t.Errorf("canNotify() with UP_STAGE=%q DBCHECK_HISTORY=%q = %v, want %v", tt.stage, tt.history, got, tt.want)
+		}
+	}
+}
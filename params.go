@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+
+	"github.com/apex/log"
+)
+
+func init() {
+	register(func(h handler) Check { return insyncCheck{h} })
+	register(func(h handler) Check { return iamCheck{h} })
+	register(func(h handler) Check { return slowLogCheck{h} })
+}
+
+type insyncCheck struct{ h handler }
+
+func (insyncCheck) ID() string          { return "insync" }
+func (insyncCheck) Description() string { return "parameter groups are in-sync on every instance" }
+func (insyncCheck) Severity() Severity  { return SeverityWarning }
+
+func (c insyncCheck) Run(ctx context.Context) (findings []Finding, err error) {
+	for _, db := range c.h.dbInfo.get().Cluster.DBClusterMembers {
+		if *db.DBClusterParameterGroupStatus != c.h.policy.ParameterStatus {
+			log.WithFields(log.Fields{
+				"db": db.DBInstanceIdentifier,
+			}).Warn("not in-sync")
+			findings = append(findings, newFinding(c, *db.DBInstanceIdentifier, "cluster parameter group is %s", *db.DBClusterParameterGroupStatus).withKind("cluster_parameter_group"))
+		}
+	}
+
+	for _, db := range c.h.dbInfo.get().DBs {
+		for _, groups := range db.DBParameterGroups {
+			if *groups.ParameterApplyStatus != c.h.policy.ParameterStatus {
+				log.WithFields(log.Fields{
+					"db":         db.DBInstanceIdentifier,
+					"paramgroup": groups.DBParameterGroupName,
+				}).Warn("not in-sync")
+				findings = append(findings, newFinding(c, *db.DBInstanceIdentifier, "parameter group %s is %s", *groups.DBParameterGroupName, *groups.ParameterApplyStatus).withKind(*groups.DBParameterGroupName))
+			}
+		}
+	}
+	return findings, nil
+}
+
+type iamCheck struct{ h handler }
+
+func (iamCheck) ID() string          { return "iam" }
+func (iamCheck) Description() string { return "IAM database authentication is enabled" }
+func (iamCheck) Severity() Severity  { return SeverityWarning }
+
+func (c iamCheck) Run(ctx context.Context) (findings []Finding, err error) {
+	for _, db := range c.h.dbInfo.get().DBs {
+		if *db.IAMDatabaseAuthenticationEnabled {
+			log.WithField("endpoint", db.Endpoint.Address).Info("IAM ENABLED")
+			continue
+		}
+		log.WithField("endpoint", db.Endpoint.Address).Warn("IAM NOT enabled")
+		findings = append(findings, newFinding(c, *db.DBInstanceIdentifier, "IAM NOT enabled"))
+	}
+	return findings, nil
+}
+
+type slowLogCheck struct{ h handler }
+
+func (slowLogCheck) ID() string          { return "slowlog" }
+func (slowLogCheck) Description() string { return "slow query log is enabled" }
+func (slowLogCheck) Severity() Severity  { return SeverityInfo }
+
+func (c slowLogCheck) Run(ctx context.Context) (findings []Finding, err error) {
+	if v := c.h.lookup("slow_query_log"); v != "1" {
+		findings = append(findings, newFinding(c, "slow_query_log", "slow_query_log is %q", v))
+	}
+	return findings, nil
+}
+
+func (h handler) lookup(key string) string {
+	for _, v := range h.dbInfo.get().Params {
+		if *v.ParameterName == key {
+			log.Infof("Looking up key: %s", key)
+			if v.ParameterValue != nil {
+				return *v.ParameterValue
+			}
+		}
+	}
+	return ""
+}
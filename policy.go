@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// duration reads a time.Duration from a string such as "15m"
+type duration time.Duration
+
+func (d duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	*d = duration(v)
+	return err
+}
+
+// policy declares the values a healthy cluster is expected to have
+type policy struct {
+	Collation       string   `json:"collation"`
+	CharacterSet    string   `json:"character_set"`
+	LambdaFunction  string   `json:"lambda_function"`
+	ParameterStatus string   `json:"parameter_status"`
+	Schemas         []string `json:"schemas"`
+	// MinBackupRetentionDays is the shortest acceptable BackupRetentionPeriod
+	MinBackupRetentionDays int64 `json:"min_backup_retention_days"`
+	// BusinessHours is a hh24:mi-hh24:mi UTC window backups must avoid
+	BusinessHours string `json:"business_hours"`
+	// MinBacktrackWindowHours is the shortest acceptable BacktrackWindow, 0
+	// tolerates backtrack being disabled
+	MinBacktrackWindowHours int64 `json:"min_backtrack_window_hours"`
+	// RequiredLogExports are the log types that must be sent to CloudWatch
+	RequiredLogExports []string `json:"required_log_exports"`
+	// MinBinlogRetentionHours is the shortest acceptable binlog retention, 0
+	// tolerates binary logging being disabled
+	MinBinlogRetentionHours int64 `json:"min_binlog_retention_hours"`
+	// AllowGeneralLog tolerates general_log being enabled
+	AllowGeneralLog bool `json:"allow_general_log"`
+	// HeadroomWarning and HeadroomCritical are the fractions of an
+	// auto_increment key's range that may be used before raising a finding
+	HeadroomWarning  float64 `json:"headroom_warning"`
+	HeadroomCritical float64 `json:"headroom_critical"`
+	// Triggers are expected to exist, any other trigger in their schemas is
+	// reported as extra
+	Triggers []trigger `json:"triggers"`
+	// Watchlist are schema.table names whose row counts are sampled every
+	// WatchInterval, a drop of RowCountDrop or more from the peak of the
+	// recent samples is reported
+	Watchlist     []string `json:"watchlist"`
+	WatchInterval duration `json:"watch_interval"`
+	RowCountDrop  float64  `json:"row_count_drop"`
+	// SchemaDir holds the expected schema snapshot of each schema version as
+	// <version>.json, schema drift is not checked when it is empty
+	SchemaDir string `json:"schema_dir"`
+	// ProcedureReference is a file of procedure fingerprints captured from
+	// the reference environment with dbcheck procedures
+	ProcedureReference string `json:"procedure_reference"`
+	// ProcedureChangeWindow is how long a procedure that changed is reported
+	ProcedureChangeWindow duration `json:"procedure_change_window"`
+	// Grants are privileges accounts must hold, beyond the lambda invoker's
+	// EXECUTE on each schema
+	Grants []requiredGrant `json:"grants"`
+	// AckURL is where the lambda function POSTs the correlation_id and
+	// token of a round trip, dbcheck's own /ack, round trips are off when it is empty
+	AckURL string `json:"ack_url"`
+	// RoundTripInterval is how often a round trip is sent and
+	// RoundTripTimeout how long its acknowledgement may take
+	RoundTripInterval duration `json:"roundtrip_interval"`
+	RoundTripTimeout  duration `json:"roundtrip_timeout"`
+	// RoundTripTable is the schema.table dbcheck creates on the cluster to
+	// keep round trips in, outside the checked schemas
+	RoundTripTable string `json:"roundtrip_table"`
+	// Notify are told when a finding appears, changes severity or resolves
+	Notify []notifier `json:"notify"`
+	// Severities overrides the default severity of a check by ID
+	Severities map[string]Severity `json:"severities"`
+	// Disabled lists the IDs of checks that are not run
+	Disabled []string `json:"disabled"`
+}
+
+var defaultPolicy = policy{
+	Collation:       "utf8mb4_unicode_520_ci",
+	CharacterSet:    "utf8mb4",
+	LambdaFunction:  "alambda_simple",
+	ParameterStatus: "in-sync",
+	Schemas:         []string{"bugzilla", "unee_t_enterprise"},
+	// a week of backups and office hours in Singapore
+	MinBackupRetentionDays:  7,
+	BusinessHours:           "01:00-10:00",
+	MinBacktrackWindowHours: 24,
+	RequiredLogExports:      []string{"error", "slowquery", "audit"},
+	MinBinlogRetentionHours: 24,
+	HeadroomWarning:         0.7,
+	HeadroomCritical:        0.9,
+	Watchlist:               []string{"bugzilla.user_group_map"},
+	WatchInterval:           duration(15 * time.Minute),
+	RowCountDrop:            0.1,
+	ProcedureChangeWindow:   duration(24 * time.Hour),
+	RoundTripInterval:       duration(5 * time.Minute),
+	RoundTripTimeout:        duration(time.Minute),
+	RoundTripTable:          "dbcheck.roundtrips",
+}
+
+// loadPolicy layers the file named by DBCHECK_POLICY, then the target's own
+// file and finally its inline policy over the defaults, so an environment
+// only declares what it does differently
+func loadPolicy(t target) (p policy, err error) {
+	p = defaultPolicy
+	p.Schemas = append([]string(nil), defaultPolicy.Schemas...)
+	p.RequiredLogExports = append([]string(nil), defaultPolicy.RequiredLogExports...)
+	p.Watchlist = append([]string(nil), defaultPolicy.Watchlist...)
+	for _, path := range []string{os.Getenv("DBCHECK_POLICY"), t.PolicyFile} {
+		if path == "" {
+			continue
+		}
+		err = p.merge(path)
+		if err != nil {
+			return p, err
+		}
+	}
+	if len(t.Policy) > 0 {
+		err = p.decode(bytes.NewReader(t.Policy))
+		if err != nil {
+			return p, fmt.Errorf("failed to parse inline policy: %w", err)
+		}
+	}
+	return p, nil
+}
+
+func (p *policy) merge(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	err = p.decode(f)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return nil
+}
+
+// decode overrides the policy with the keys present in r, rejecting unknown
+// keys so a typo like "disable" doesn't silently leave every check enabled
+func (p *policy) decode(r io.Reader) error {
+	d := json.NewDecoder(r)
+	d.DisallowUnknownFields()
+	return d.Decode(p)
+}
+
+func (p policy) disabled(id string) bool {
+	for _, v := range p.Disabled {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
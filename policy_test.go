@@ -0,0 +1,30 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestLoadPolicy(t *testing.T) {
+	p, err := loadPolicy(target{Policy: json.RawMessage(`{"disabled": ["backtrack"], "min_backup_retention_days": 14}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.disabled("backtrack") || p.MinBackupRetentionDays != 14 {
+		t.Errorf("inline policy not applied: %+v", p)
+	}
+	if len(p.Schemas) == 0 {
+		t.Error("inline policy dropped the default schemas")
+	}
+
+	for _, inline := range []string{
+		`{"disable": ["backtrack"]}`,
+		`{"notify": [{"type": "slack", "urll": "https://hooks.slack.com/services/x"}]}`,
+	} {
+		_, err := loadPolicy(target{Policy: json.RawMessage(inline)})
+		if err == nil || !strings.Contains(err.Error(), "unknown field") {
+			t.Errorf("loadPolicy(%s) = %v, want an unknown field error", inline, err)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/apex/log"
+)
+
+// InnoDB index key prefix limits in bytes, 767 unless the row format allows
+// large prefixes
+const (
+	indexPrefixLimit      = 767
+	largeIndexPrefixLimit = 3072
+)
+
+type indexColumn struct {
+	Schema    string        `db:"TABLE_SCHEMA"`
+	Table     string        `db:"TABLE_NAME"`
+	Index     string        `db:"INDEX_NAME"`
+	Column    string        `db:"COLUMN_NAME"`
+	SubPart   sql.NullInt64 `db:"SUB_PART"`
+	MaxLength sql.NullInt64 `db:"CHARACTER_MAXIMUM_LENGTH"`
+}
+
+// utf8mb4Length is the bytes a character index part needs once converted
+func (c indexColumn) utf8mb4Length() int64 {
+	chars := c.MaxLength.Int64
+	if c.SubPart.Valid {
+		chars = c.SubPart.Int64
+	}
+	return chars * 4
+}
+
+// remediation writes an ordered SQL script bringing databases, tables and
+// routines onto the policy character set and collation
+func (h handler) remediation(w io.Writer) error {
+	p := h.policy
+	fmt.Fprintf(w, "-- Collation remediation for %s (%s), generated by dbcheck %s\n", h.Cluster, h.AccountID, commit)
+	fmt.Fprintf(w, "-- Review before running, converting tables rewrites them and takes locks\n\n")
+
+	var schemata []struct {
+		Name         string `db:"SCHEMA_NAME"`
+		CharacterSet string `db:"DEFAULT_CHARACTER_SET_NAME"`
+		Collation    string `db:"DEFAULT_COLLATION_NAME"`
+	}
+	err := h.selectIn(&schemata, `SELECT SCHEMA_NAME, DEFAULT_CHARACTER_SET_NAME, DEFAULT_COLLATION_NAME
+FROM information_schema.SCHEMATA WHERE SCHEMA_NAME IN (?) ORDER BY SCHEMA_NAME`)
+	if err != nil {
+		return fmt.Errorf("failed to list databases: %w", err)
+	}
+	fmt.Fprintf(w, "-- 1. Databases\n")
+	for _, s := range schemata {
+		if s.CharacterSet == p.CharacterSet && s.Collation == p.Collation {
+			continue
+		}
+		fmt.Fprintf(w, "-- %s is %s %s\n", s.Name, s.CharacterSet, s.Collation)
+		fmt.Fprintf(w, "ALTER DATABASE %s CHARACTER SET %s COLLATE %s;\n", quoteIdent(s.Name), p.CharacterSet, p.Collation)
+	}
+
+	dbs, err := h.databaseCollations()
+	if err != nil {
+		return err
+	}
+	var columns []indexColumn
+	err = h.selectIn(&columns, `SELECT s.TABLE_SCHEMA, s.TABLE_NAME, s.INDEX_NAME, s.COLUMN_NAME, s.SUB_PART, c.CHARACTER_MAXIMUM_LENGTH
+FROM information_schema.STATISTICS s
+JOIN information_schema.COLUMNS c ON c.TABLE_SCHEMA = s.TABLE_SCHEMA AND c.TABLE_NAME = s.TABLE_NAME AND c.COLUMN_NAME = s.COLUMN_NAME
+WHERE c.CHARACTER_MAXIMUM_LENGTH IS NOT NULL AND s.TABLE_SCHEMA IN (?)
+ORDER BY s.TABLE_SCHEMA, s.TABLE_NAME, s.INDEX_NAME, s.SEQ_IN_INDEX`)
+	if err != nil {
+		return fmt.Errorf("failed to list index columns: %w", err)
+	}
+
+	fmt.Fprintf(w, "\n-- 2. Tables\n")
+	for _, db := range dbs {
+		for _, t := range db.Tables {
+			if !t.Collation.Valid || t.Collation.String == p.Collation {
+				continue
+			}
+			for _, warning := range indexWarnings(db.Name, t, columns) {
+				fmt.Fprintf(w, "-- WARNING: %s\n", warning)
+			}
+			fmt.Fprintf(w, "-- %s.%s is %s\n", db.Name, t.Name, t.Collation.String)
+			fmt.Fprintf(w, "ALTER TABLE %s.%s CONVERT TO CHARACTER SET %s COLLATE %s;\n", quoteIdent(db.Name), quoteIdent(t.Name), p.CharacterSet, p.Collation)
+		}
+	}
+
+	procs, err := h.procedures()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "\n-- 3. Routines, recreated so they capture the connection character set\n")
+	fmt.Fprintf(w, "SET NAMES %s COLLATE %s;\n", p.CharacterSet, p.Collation)
+	fmt.Fprintf(w, "SET @dbcheck_sql_mode = @@SESSION.sql_mode;\n")
+	for _, v := range procs {
+		if !v.CorrectCollation {
+			recreateRoutine(w, v)
+		}
+	}
+	fmt.Fprintf(w, "SET SESSION sql_mode = @dbcheck_sql_mode;\n")
+	return nil
+}
+
+// recreateRoutine drops and recreates a routine under the sql_mode it was
+// created with, which is part of its semantics
+func recreateRoutine(w io.Writer, v CreateProcedure) {
+	fmt.Fprintf(w, "-- %s.%s character_set_client %s, database collation %s\n", v.Database, v.Procedure, v.CharacterSetClient, v.DatabaseCollation)
+	if !v.Source.Valid {
+		fmt.Fprintf(w, "-- WARNING: source of %s.%s is not visible, recreate it by hand\n", v.Database, v.Procedure)
+		return
+	}
+	fmt.Fprintf(w, "USE %s;\n", quoteIdent(v.Database))
+	fmt.Fprintf(w, "DROP PROCEDURE IF EXISTS %s;\n", quoteIdent(v.Procedure))
+	fmt.Fprintf(w, "SET SESSION sql_mode = %s;\n", quoteString(v.SqlMode))
+	fmt.Fprintf(w, "DELIMITER ;;\n%s;;\nDELIMITER ;\n", v.Source.String)
+}
+
+// indexWarnings lists the indexes of a table whose keys will exceed InnoDB's
+// prefix limits once every character takes four bytes
+func indexWarnings(schema string, t tableStatus, columns []indexColumn) (warnings []string) {
+	limit := int64(indexPrefixLimit)
+	switch strings.ToUpper(t.RowFormat.String) {
+	case "DYNAMIC", "COMPRESSED":
+		limit = largeIndexPrefixLimit
+	}
+	totals := map[string]int64{}
+	var order []string
+	for _, c := range columns {
+		if c.Schema != schema || c.Table != t.Name {
+			continue
+		}
+		length := c.utf8mb4Length()
+		if length > limit {
+			warnings = append(warnings, fmt.Sprintf("index %s column %s needs %d bytes, over the %d byte limit of row format %s", c.Index, c.Column, length, limit, t.RowFormat.String))
+		}
+		if _, ok := totals[c.Index]; !ok {
+			order = append(order, c.Index)
+		}
+		totals[c.Index] += length
+	}
+	for _, index := range order {
+		if totals[index] > largeIndexPrefixLimit {
+			warnings = append(warnings, fmt.Sprintf("index %s needs %d bytes, over the %d byte key limit", index, totals[index], largeIndexPrefixLimit))
+		}
+	}
+	return warnings
+}
+
+func (h handler) remediate(w http.ResponseWriter, r *http.Request) {
+	// a script cut short by an error must not pass for a complete one
+	var script bytes.Buffer
+	err := h.remediation(&script)
+	if err != nil {
+		log.WithError(err).Error("failed to generate remediation")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	script.WriteTo(w)
+}
+
+// remediate writes the remediation script of a target to stdout
+func remediate(args []string) int {
+	fs := flag.NewFlagSet("remediate", flag.ExitOnError)
+	cluster := fs.String("cluster", "", "name of the target to remediate, defaults to the first")
+	fs.Parse(args)
+
+	f, err := newFleet()
+	if err != nil {
+		log.WithError(err).Error("error setting configuration")
+		return 2
+	}
+	defer f.Close()
+
+	h, err := f.named(*cluster)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	var script bytes.Buffer
+	err = h.remediation(&script)
+	if err != nil {
+		log.WithError(err).Error("failed to generate remediation")
+		return 1
+	}
+	script.WriteTo(os.Stdout)
+	return 0
+}
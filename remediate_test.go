@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"testing"
+)
+
+func TestRecreateRoutine(t *testing.T) {
+	tests := []struct {
+		name string
+		v    CreateProcedure
+		want string
+	}{
+		{
+			name: "keeps sql_mode",
+			v: CreateProcedure{
+				Database:           "bugzilla",
+				Procedure:          "lambda_notification",
+				SqlMode:            "STRICT_TRANS_TABLES,NO_ENGINE_SUBSTITUTION",
+				Source:             sql.NullString{String: "CREATE PROCEDURE `lambda_notification`()\nBEGIN\nEND", Valid: true},
+				CharacterSetClient: "utf8",
+				DatabaseCollation:  "utf8_general_ci",
+			},
+			want: "-- bugzilla.lambda_notification character_set_client utf8, database collation utf8_general_ci\n" +
+				"USE `bugzilla`;\n" +
+				"DROP PROCEDURE IF EXISTS `lambda_notification`;\n" +
+				"SET SESSION sql_mode = 'STRICT_TRANS_TABLES,NO_ENGINE_SUBSTITUTION';\n" +
+				"DELIMITER ;;\nCREATE PROCEDURE `lambda_notification`()\nBEGIN\nEND;;\nDELIMITER ;\n",
+		},
+		{
+			name: "quotes identifiers",
+			v: CreateProcedure{
+				Database:  "unee`t",
+				Procedure: "p",
+				Source:    sql.NullString{String: "CREATE PROCEDURE `p`() SELECT 1", Valid: true},
+			},
+			want: "-- unee`t.p character_set_client , database collation \n" +
+				"USE `unee``t`;\n" +
+				"DROP PROCEDURE IF EXISTS `p`;\n" +
+				"SET SESSION sql_mode = '';\n" +
+				"DELIMITER ;;\nCREATE PROCEDURE `p`() SELECT 1;;\nDELIMITER ;\n",
+		},
+		{
+			name: "invisible source",
+			v:    CreateProcedure{Database: "bugzilla", Procedure: "p"},
+			want: "-- bugzilla.p character_set_client , database collation \n" +
+				"-- WARNING: source of bugzilla.p is not visible, recreate it by hand\n",
+		},
+	}
+	for _, tt := range tests {
+		var b bytes.Buffer
+		recreateRoutine(&b, tt.v)
+		if got := b.String(); got != tt.want {
+			t.Errorf("%s:\n got %q\nwant %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// wantsJSON reports whether the client asked for a machine readable report
+// with either ?format=json or an Accept header
+func wantsJSON(r *http.Request) bool {
+	if f := r.URL.Query().Get("format"); f != "" {
+		return f == "json"
+	}
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+type checksReport struct {
+	Findings   []Finding         `json:"findings"`
+	Procedures []procedureReport `json:"procedures"`
+}
+
+type procedureReport struct {
+	Database            string   `json:"database"`
+	Procedure           string   `json:"procedure"`
+	SqlMode             string   `json:"sql_mode"`
+	Source              string   `json:"source"`
+	CharacterSetClient  string   `json:"character_set_client"`
+	CollationConnection string   `json:"collation_connection"`
+	DatabaseCollation   string   `json:"database_collation"`
+	CorrectCollation    bool     `json:"correct_collation"`
+	LambdaProblems      []string `json:"lambda_problems"`
+	Functions           []string `json:"functions"`
+}
+
+func newProcedureReport(p CreateProcedure) procedureReport {
+	problems := p.LambdaProblems
+	if problems == nil {
+		problems = []string{}
+	}
+	functions := p.Functions
+	if functions == nil {
+		functions = []string{}
+	}
+	return procedureReport{
+		Database:            p.Database,
+		Procedure:           p.Procedure,
+		SqlMode:             p.SqlMode,
+		Source:              p.Source.String,
+		CharacterSetClient:  p.CharacterSetClient,
+		CollationConnection: p.CollationConnection,
+		DatabaseCollation:   p.DatabaseCollation,
+		CorrectCollation:    p.CorrectCollation,
+		LambdaProblems:      problems,
+		Functions:           functions,
+	}
+}
+
+type unicodeReport struct {
+	Findings  []Finding        `json:"findings"`
+	Databases []databaseReport `json:"databases"`
+}
+
+type databaseReport struct {
+	Name           string        `json:"name"`
+	CreateDatabase string        `json:"create_database"`
+	Tables         []tableReport `json:"tables"`
+}
+
+type tableReport struct {
+	Name             string `json:"name"`
+	Collation        string `json:"collation"`
+	CorrectCollation bool   `json:"correct_collation"`
+}
+
+func newDatabaseReport(db dbunicode, collation string) databaseReport {
+	report := databaseReport{Name: db.Name, Tables: []tableReport{}}
+	for _, v := range db.Info {
+		report.CreateDatabase = v.CreateDatabase
+	}
+	for _, t := range db.Tables {
+		report.Tables = append(report.Tables, tableReport{
+			Name:             t.Name,
+			Collation:        t.Collation.String,
+			CorrectCollation: t.Collation.Valid && t.Collation.String == collation,
+		})
+	}
+	return report
+}
@@ -0,0 +1,423 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/go-sql-driver/mysql"
+	"github.com/tj/go/http/response"
+)
+
+func init() {
+	register(func(h handler) Check { return roundTripCheck{h} })
+}
+
+const (
+	// roundTripHistory is how many round trips /roundtrips lists
+	roundTripHistory = 48
+	// roundTripPoll is how often /call looks for its acknowledgement
+	roundTripPoll = time.Second
+)
+
+// roundTrip is a mysql.lambda_async call the function acknowledges by posting
+// its correlation ID and token back to the policy's ack_url. Round trips live
+// in the policy's roundtrip_table on the cluster itself, so whichever
+// container receives the acknowledgement or evaluates the check sees them.
+type roundTrip struct {
+	ID       string     `db:"correlation_id" json:"correlation_id"`
+	Function string     `db:"function_arn" json:"function"`
+	Sent     time.Time  `db:"sent_at" json:"sent"`
+	Acked    *time.Time `db:"acked_at" json:"acknowledged,omitempty"`
+	Latency  float64    `db:"-" json:"latency_seconds,omitempty"`
+	Error    string     `db:"failure" json:"error,omitempty"`
+}
+
+func (rt roundTrip) completed() bool {
+	return rt.Acked != nil || rt.Error != ""
+}
+
+// roundTripLog is the recent round trips of a target, newest first, and the
+// totals ever sent
+type roundTripLog struct {
+	Recent []roundTrip `json:"recent"`
+	Acked  int         `json:"acked"`
+	Failed int         `json:"failed"`
+}
+
+// last returns the most recently completed round trip
+func (l roundTripLog) last() (roundTrip, bool) {
+	for _, rt := range l.Recent {
+		if rt.completed() {
+			return rt, true
+		}
+	}
+	return roundTrip{}, false
+}
+
+func randomHex() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// tokenHash is what the table keeps of a round trip's token, so reading the
+// table is not enough to acknowledge a call
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// roundTripTable is the quoted schema and name of the policy's roundtrip_table
+func (h handler) roundTripTable() (schema, table string, err error) {
+	parts := strings.Split(h.policy.RoundTripTable, ".")
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("roundtrip_table %q is not schema.table", h.policy.RoundTripTable)
+	}
+	return quoteIdent(parts[0]), quoteIdent(parts[0]) + "." + quoteIdent(parts[1]), nil
+}
+
+// noSuchTable reports whether a query failed because the round trip table
+// has not been created yet, as before the first round trip
+func noSuchTable(err error) bool {
+	var e *mysql.MySQLError
+	return errors.As(err, &e) && e.Number == 1146
+}
+
+// createRoundTripTable creates the round trip table unless it exists
+func (h handler) createRoundTripTable(ctx context.Context) error {
+	schema, table, err := h.roundTripTable()
+	if err != nil {
+		return err
+	}
+	_, err = h.db.ExecContext(ctx, "CREATE DATABASE IF NOT EXISTS "+schema)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", schema, err)
+	}
+	_, err = h.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+table+` (
+	correlation_id CHAR(32) NOT NULL PRIMARY KEY,
+	token_sha256 CHAR(64) NOT NULL,
+	function_arn VARCHAR(255) NOT NULL,
+	sent_at DATETIME(6) NOT NULL,
+	acked_at DATETIME(6) NULL,
+	failure VARCHAR(255) NOT NULL DEFAULT '',
+	KEY sent_at (sent_at)
+)`)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", table, err)
+	}
+	return nil
+}
+
+// sendRoundTrip calls the policy function through mysql.lambda_async with a
+// payload carrying a fresh correlation ID and the token to acknowledge it with
+func (h handler) sendRoundTrip(ctx context.Context) (rt roundTrip, err error) {
+	_, table, err := h.roundTripTable()
+	if err != nil {
+		return rt, err
+	}
+	rt.ID, err = randomHex()
+	if err != nil {
+		return rt, err
+	}
+	token, err := randomHex()
+	if err != nil {
+		return rt, err
+	}
+	rt.Function, err = h.defaultFunction()
+	if err != nil {
+		return rt, err
+	}
+	rt.Sent = time.Now().UTC()
+	payload, err := json.Marshal(map[string]string{
+		"heartbeat":      rt.Sent.Format(time.RFC3339Nano),
+		"correlation_id": rt.ID,
+		"token":          token,
+		"ack_url":        h.policy.AckURL,
+	})
+	if err != nil {
+		return rt, err
+	}
+	err = h.createRoundTripTable(ctx)
+	if err != nil {
+		return rt, err
+	}
+	_, err = h.db.ExecContext(ctx, `INSERT INTO `+table+` (correlation_id, token_sha256, function_arn, sent_at) VALUES (?, ?, ?, ?)`,
+		rt.ID, tokenHash(token), rt.Function, rt.Sent)
+	if err != nil {
+		return rt, fmt.Errorf("failed to record round trip: %w", err)
+	}
+	_, err = h.db.ExecContext(ctx, `CALL mysql.lambda_async(?, ?)`, rt.Function, string(payload))
+	if err != nil {
+		rt.Error = err.Error()
+		h.db.ExecContext(ctx, `UPDATE `+table+` SET failure = ? WHERE correlation_id = ?`, truncate(rt.Error, 255), rt.ID)
+		return rt, fmt.Errorf("failed to make mysql.lambda_async call: %w", err)
+	}
+	log.WithFields(log.Fields{"function": rt.Function, "correlation_id": rt.ID}).Info("sent")
+	return rt, nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// ackRoundTrip acknowledges a pending round trip whose token matches
+func (h handler) ackRoundTrip(ctx context.Context, id, token string, now time.Time) (bool, error) {
+	_, table, err := h.roundTripTable()
+	if err != nil {
+		return false, err
+	}
+	res, err := h.db.ExecContext(ctx, `UPDATE `+table+` SET acked_at = ?
+WHERE correlation_id = ? AND token_sha256 = ? AND acked_at IS NULL AND failure = ''`,
+		now.UTC(), id, tokenHash(token))
+	if noSuchTable(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// expireRoundTrips fails round trips not acknowledged within the policy
+// timeout
+func (h handler) expireRoundTrips(ctx context.Context, now time.Time) error {
+	_, table, err := h.roundTripTable()
+	if err != nil {
+		return err
+	}
+	timeout := time.Duration(h.policy.RoundTripTimeout)
+	_, err = h.db.ExecContext(ctx, `UPDATE `+table+` SET failure = ?
+WHERE acked_at IS NULL AND failure = '' AND sent_at <= ?`,
+		fmt.Sprintf("not acknowledged within %s", timeout), now.Add(-timeout).UTC())
+	if noSuchTable(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to expire round trips: %w", err)
+	}
+	return nil
+}
+
+// roundTrips reads the recent round trips of the target
+func (h handler) roundTrips(ctx context.Context) (l roundTripLog, err error) {
+	_, table, err := h.roundTripTable()
+	if err != nil {
+		return l, err
+	}
+	err = h.probe("roundtrips", &l, func() error {
+		err := h.db.SelectContext(ctx, &l.Recent, `SELECT correlation_id, function_arn, sent_at, acked_at, failure FROM `+table+`
+ORDER BY sent_at DESC LIMIT ?`, roundTripHistory)
+		if noSuchTable(err) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to list round trips: %w", err)
+		}
+		err = h.db.QueryRowContext(ctx, `SELECT COUNT(acked_at), COUNT(NULLIF(failure, '')) FROM `+table).Scan(&l.Acked, &l.Failed)
+		if err != nil {
+			return fmt.Errorf("failed to count round trips: %w", err)
+		}
+		return nil
+	})
+	for i, rt := range l.Recent {
+		if rt.Acked != nil {
+			l.Recent[i].Latency = rt.Acked.Sub(rt.Sent).Seconds()
+		}
+	}
+	return l, err
+}
+
+// keepRoundTripping expires late round trips and sends one when none was sent
+// within the policy interval by any container. Evaluations call it as well as
+// the background probe, which stops while a Lambda container is frozen.
+func (h handler) keepRoundTripping(ctx context.Context) error {
+	if h.policy.AckURL == "" || h.recorder != nil {
+		return nil
+	}
+	now := time.Now()
+	err := h.expireRoundTrips(ctx, now)
+	if err != nil {
+		return err
+	}
+	l, err := h.roundTrips(ctx)
+	if err != nil {
+		return err
+	}
+	if len(l.Recent) > 0 && now.Sub(l.Recent[0].Sent) < time.Duration(h.policy.RoundTripInterval) {
+		return nil
+	}
+	_, err = h.sendRoundTrip(ctx)
+	return err
+}
+
+// watchRoundTrips keeps round tripping every policy interval until ctx is done
+func (h handler) watchRoundTrips(ctx context.Context) {
+	interval := time.Duration(h.policy.RoundTripInterval)
+	if h.policy.AckURL == "" || interval <= 0 {
+		return
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		err := h.keepRoundTripping(ctx)
+		if err != nil {
+			log.WithError(err).Error("failed to send round trip")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// call invokes the policy function, waiting for its acknowledgement when the
+// policy has an ack_url
+func (h handler) call(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	rt, err := h.sendRoundTrip(ctx)
+	if err != nil {
+		log.WithError(err).Error("failed to make mysql.lambda_async call")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if h.policy.AckURL == "" {
+		fmt.Fprintf(w, "OK %s", rt.ID)
+		return
+	}
+
+	// the acknowledgement may reach another container, so wait on the table
+	timeout := time.Duration(h.policy.RoundTripTimeout)
+	deadline := time.After(timeout)
+	poll := time.NewTicker(roundTripPoll)
+	defer poll.Stop()
+	for !rt.completed() {
+		select {
+		case <-poll.C:
+		case <-deadline:
+			err = h.expireRoundTrips(ctx, rt.Sent.Add(timeout))
+		case <-ctx.Done():
+			return
+		}
+		if err == nil {
+			rt, err = h.roundTrip(ctx, rt.ID)
+		}
+		if err != nil {
+			log.WithError(err).Error("failed to read round trip")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if rt.Error != "" {
+		w.WriteHeader(http.StatusGatewayTimeout)
+	}
+	response.JSON(w, rt)
+}
+
+// roundTrip reads one round trip
+func (h handler) roundTrip(ctx context.Context, id string) (rt roundTrip, err error) {
+	_, table, err := h.roundTripTable()
+	if err != nil {
+		return rt, err
+	}
+	err = h.db.GetContext(ctx, &rt, `SELECT correlation_id, function_arn, sent_at, acked_at, failure FROM `+table+` WHERE correlation_id = ?`, id)
+	if rt.Acked != nil {
+		rt.Latency = rt.Acked.Sub(rt.Sent).Seconds()
+	}
+	return rt, err
+}
+
+func (h handler) roundTripHistory(w http.ResponseWriter, r *http.Request) {
+	l, err := h.roundTrips(r.Context())
+	if err != nil {
+		log.WithError(err).Error("failed to list round trips")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	response.JSON(w, l.Recent)
+}
+
+// ack receives acknowledgements from the invoked function, as a POSTed
+// {"correlation_id": ..., "token": ...} or ?correlation_id=&token=. Only the
+// token sent with a call acknowledges it, so /ack needs no API token.
+func (f fleet) ack(w http.ResponseWriter, r *http.Request) {
+	id, token := r.URL.Query().Get("correlation_id"), r.URL.Query().Get("token")
+	if r.Method == http.MethodPost {
+		var body struct {
+			ID    string `json:"correlation_id"`
+			Token string `json:"token"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		id, token = body.ID, body.Token
+	}
+	if id == "" || token == "" {
+		http.Error(w, "correlation_id and token are required", http.StatusBadRequest)
+		return
+	}
+	now := time.Now()
+	for _, h := range f {
+		if h.policy.AckURL == "" || h.db == nil {
+			continue
+		}
+		ok, err := h.ackRoundTrip(r.Context(), id, token, now)
+		if err != nil {
+			log.WithError(err).WithField("cluster", h.Cluster).Error("failed to acknowledge round trip")
+			continue
+		}
+		if ok {
+			log.WithFields(log.Fields{"correlation_id": id, "cluster": h.Cluster}).Info("acknowledged")
+			response.OK(w)
+			return
+		}
+	}
+	http.Error(w, "no pending round trip with that correlation_id and token", http.StatusNotFound)
+}
+
+type roundTripCheck struct{ h handler }
+
+func (roundTripCheck) ID() string { return "lambda_roundtrip" }
+func (roundTripCheck) Description() string {
+	return "the lambda function acknowledges mysql.lambda_async calls"
+}
+func (roundTripCheck) Severity() Severity { return SeverityCritical }
+
+func (c roundTripCheck) Run(ctx context.Context) (findings []Finding, err error) {
+	h := c.h
+	if h.policy.AckURL == "" {
+		return nil, nil
+	}
+	// send when the schedule has not, e.g. a frozen Lambda container
+	err = h.keepRoundTripping(ctx)
+	if err != nil {
+		return nil, err
+	}
+	l, err := h.roundTrips(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rt, ok := l.last()
+	if !ok || rt.Error == "" {
+		return nil, nil
+	}
+	return []Finding{newFinding(c, rt.Function, "round trip %s sent at %s failed: %s (%d failed in total)",
+		rt.ID, rt.Sent.Format(time.RFC3339), rt.Error, l.Failed)}, nil
+}
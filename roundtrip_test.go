@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRoundTripTable(t *testing.T) {
+	tests := []struct {
+		table        string
+		schema, want string
+		wantErr      bool
+	}{
+		{"dbcheck.roundtrips", "`dbcheck`", "`dbcheck`.`roundtrips`", false},
+		{"ops.round`trips", "`ops`", "`ops`.`round``trips`", false},
+		{"roundtrips", "", "", true},
+		{"a.b.c", "", "", true},
+	}
+	for _, tt := range tests {
+		h := handler{policy: policy{RoundTripTable: tt.table}}
+		schema, got, err := h.roundTripTable()
+		if (err != nil) != tt.wantErr || schema != tt.schema || got != tt.want {
+			t.Errorf("roundTripTable(%q) = %s, %s, %v, want %s, %s", tt.table, schema, got, err, tt.schema, tt.want)
+		}
+	}
+}
+
+func TestRoundTripLogLast(t *testing.T) {
+	now := time.Now()
+	l := roundTripLog{Recent: []roundTrip{
+		{ID: "pending", Sent: now},
+		{ID: "failed", Sent: now.Add(-time.Minute), Error: "not acknowledged within 1m0s"},
+		{ID: "acked", Sent: now.Add(-2 * time.Minute), Acked: &now},
+	}}
+	if rt, ok := l.last(); !ok || rt.ID != "failed" {
+		t.Errorf("last() = %s, %v, want the failed round trip", rt.ID, ok)
+	}
+	if _, ok := (roundTripLog{Recent: l.Recent[:1]}).last(); ok {
+		t.Error("last() of only a pending round trip succeeded")
+	}
+	if tokenHash("a") == tokenHash("b") || len(tokenHash("a")) != 64 {
+		t.Errorf("tokenHash(%q) = %s", "a", tokenHash("a"))
+	}
+}
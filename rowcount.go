@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+)
+
+func init() {
+	register(func(h handler) Check { return rowCountCheck{h} })
+}
+
+// rowCountHistory is how many samples of each table are kept
+const rowCountHistory = 48
+
+type rowCountSample struct {
+	Taken time.Time `json:"taken"`
+	Rows  int64     `json:"rows"`
+}
+
+// rowCounter keeps recent row counts of the watchlist tables
+type rowCounter struct {
+	mu      sync.Mutex
+	taken   time.Time
+	samples map[string][]rowCountSample
+}
+
+func newRowCounter() *rowCounter {
+	return &rowCounter{samples: map[string][]rowCountSample{}}
+}
+
+func (rc *rowCounter) add(table string, s rowCountSample) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	samples := append(rc.samples[table], s)
+	if len(samples) > rowCountHistory {
+		samples = samples[len(samples)-rowCountHistory:]
+	}
+	rc.samples[table] = samples
+	rc.taken = s.Taken
+}
+
+// last returns the most recent sample of a table
+func (rc *rowCounter) last(table string) (rowCountSample, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	samples := rc.samples[table]
+	if len(samples) == 0 {
+		return rowCountSample{}, false
+	}
+	return samples[len(samples)-1], true
+}
+
+// peak returns the largest retained sample of a table and the latest one
+func (rc *rowCounter) peak(table string) (peak, current rowCountSample, ok bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	samples := rc.samples[table]
+	if len(samples) < 2 {
+		return peak, current, false
+	}
+	for _, s := range samples {
+		if s.Rows >= peak.Rows {
+			peak = s
+		}
+	}
+	return peak, samples[len(samples)-1], true
+}
+
+// seed gives a table without samples the ones it had before a restart
+func (rc *rowCounter) seed(table string, samples []rowCountSample) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if len(rc.samples[table]) > 0 {
+		return
+	}
+	if len(samples) > rowCountHistory {
+		samples = samples[len(samples)-rowCountHistory:]
+	}
+	rc.samples[table] = samples
+}
+
+func (rc *rowCounter) due(interval time.Duration, now time.Time) bool {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return now.Sub(rc.taken) >= interval
+}
+
+// sampleRowCounts counts the rows of every watchlist table
+func (h handler) sampleRowCounts() error {
+	now := time.Now()
+	for _, table := range h.policy.Watchlist {
+		parts := strings.Split(table, ".")
+		if len(parts) != 2 {
+			return fmt.Errorf("watchlist table %q is not schema.table", table)
+		}
+		h.rowCounts.seed(table, h.recordedRowCounts(table, now))
+		var count int64
+		err := h.probe("row_count/"+table, &count, func() error {
+			return h.db.Get(&count, fmt.Sprintf("SELECT COUNT(*) FROM %s.%s", quoteIdent(parts[0]), quoteIdent(parts[1])))
+		})
+		if err != nil {
+			return fmt.Errorf("failed to count %s: %w", table, err)
+		}
+		log.WithFields(log.Fields{"table": table, "rows": count}).Info("sampled")
+		h.rowCounts.add(table, rowCountSample{Taken: now, Rows: count})
+	}
+	return nil
+}
+
+// recordedRowCounts are the row counts of a table the history recorded within
+// the span the samples cover, so a truncation across a restart or cold start
+// is still compared with the counts before it
+func (h handler) recordedRowCounts(table string, now time.Time) (samples []rowCountSample) {
+	if h.history == nil {
+		return nil
+	}
+	interval := time.Duration(h.policy.WatchInterval)
+	if interval <= 0 {
+		interval = time.Duration(defaultPolicy.WatchInterval)
+	}
+	span := interval * rowCountHistory
+	for _, v := range h.history.series(h.AccountID, h.Cluster, "row_count/"+table) {
+		if now.Sub(v.LastSeen) > span {
+			continue
+		}
+		rows, err := strconv.ParseInt(v.Value, 10, 64)
+		if err != nil {
+			continue
+		}
+		samples = append(samples, rowCountSample{Taken: v.LastSeen, Rows: rows})
+	}
+	return samples
+}
+
+// watchRowCounts samples the watchlist every policy interval until ctx is done
+func (h handler) watchRowCounts(ctx context.Context) {
+	interval := time.Duration(h.policy.WatchInterval)
+	if interval <= 0 {
+		return
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		err := h.sampleRowCounts()
+		if err != nil {
+			log.WithError(err).Error("failed to sample row counts")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// rowDrop is the fraction of rows lost since the peak of the retained
+// samples, so a truncation is reported until the table recovers rather than
+// only until the next sample
+func (h handler) rowDrop(table string) (drop float64, previous, current rowCountSample, ok bool) {
+	previous, current, ok = h.rowCounts.peak(table)
+	if !ok || previous.Rows == 0 || current.Rows >= previous.Rows {
+		return 0, previous, current, ok
+	}
+	return float64(previous.Rows-current.Rows) / float64(previous.Rows), previous, current, ok
+}
+
+type rowCountCheck struct{ h handler }
+
+func (rowCountCheck) ID() string { return "row_counts" }
+func (rowCountCheck) Description() string {
+	return "watchlist tables have not suddenly lost rows, e.g. been truncated"
+}
+func (rowCountCheck) Severity() Severity { return SeverityCritical }
+
+func (c rowCountCheck) Run(ctx context.Context) (findings []Finding, err error) {
+	h := c.h
+	// sample when the schedule has not, e.g. a one-shot lint
+	if h.rowCounts.due(time.Duration(h.policy.WatchInterval), time.Now()) {
+		err = h.sampleRowCounts()
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, table := range h.policy.Watchlist {
+		drop, previous, current, ok := h.rowDrop(table)
+		if !ok || drop < h.policy.RowCountDrop {
+			continue
+		}
+		findings = append(findings, newFinding(c, table, "dropped %.0f%% from %d rows at %s to %d rows at %s",
+			drop*100,
+			previous.Rows, previous.Taken.Format(time.RFC3339),
+			current.Rows, current.Taken.Format(time.RFC3339)))
+	}
+	return findings, nil
+}
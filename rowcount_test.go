@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRowDropAcrossRestart(t *testing.T) {
+	const table = "bugzilla.bugs"
+	start := time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC)
+	history := &historyStore{}
+	for i, rows := range []string{"1000", "1200", "1100"} {
+		history.observe("a", "c", "row_count/"+table, rows, start.Add(time.Duration(i)*time.Hour))
+	}
+	// counts recorded before the samples span are not a baseline
+	history.observe("a", "c", "row_count/bugzilla.profiles", "5000", start.Add(-24*time.Hour))
+
+	h := handler{
+		AccountID: "a",
+		Cluster:   "c",
+		policy:    defaultPolicy,
+		history:   history,
+		rowCounts: newRowCounter(),
+	}
+	now := start.Add(3 * time.Hour)
+	h.rowCounts.seed(table, h.recordedRowCounts(table, now))
+	h.rowCounts.add(table, rowCountSample{Taken: now, Rows: 600})
+
+	drop, previous, current, ok := h.rowDrop(table)
+	if !ok || previous.Rows != 1200 || current.Rows != 600 || drop != 0.5 {
+		t.Errorf("rowDrop = %v from %d to %d (%v), want 0.5 from 1200 to 600", drop, previous.Rows, current.Rows, ok)
+	}
+	if samples := h.recordedRowCounts("bugzilla.profiles", now); len(samples) != 0 {
+		t.Errorf("recorded %v outside the samples span", samples)
+	}
+
+	// a table already sampled since the restart keeps its samples
+	h.rowCounts.seed(table, []rowCountSample{{Taken: start, Rows: 1e6}})
+	if _, previous, _, _ := h.rowDrop(table); previous.Rows != 1200 {
+		t.Errorf("seed replaced live samples, peak %d", previous.Rows)
+	}
+}
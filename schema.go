@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/jmoiron/sqlx"
+)
+
+func init() {
+	register(func(h handler) Check { return schemaDriftCheck{h} })
+}
+
+// schemaSnapshot is the structure of each schema's tables, keyed by schema
+// then table name
+type schemaSnapshot map[string]map[string]*tableSchema
+
+type tableSchema struct {
+	Collation string                  `json:"collation"`
+	Columns   map[string]columnSchema `json:"columns"`
+	Indexes   map[string]indexSchema  `json:"indexes"`
+}
+
+type columnSchema struct {
+	Type      string `json:"type"`
+	Nullable  bool   `json:"nullable"`
+	Collation string `json:"collation,omitempty"`
+}
+
+type indexSchema struct {
+	Columns []string `json:"columns"`
+	Unique  bool     `json:"unique"`
+}
+
+func (s schemaSnapshot) table(schema, name string) *tableSchema {
+	if s[schema] == nil {
+		s[schema] = map[string]*tableSchema{}
+	}
+	t, ok := s[schema][name]
+	if !ok {
+		t = &tableSchema{Columns: map[string]columnSchema{}, Indexes: map[string]indexSchema{}}
+		s[schema][name] = t
+	}
+	return t
+}
+
+// liveSchema reads the tables, columns and indexes of the policy schemas
+func (h handler) liveSchema() (snapshot schemaSnapshot, err error) {
+	err = h.probe("schema", &snapshot, func() error {
+		snapshot = schemaSnapshot{}
+
+		var tables []struct {
+			Schema    string         `db:"TABLE_SCHEMA"`
+			Name      string         `db:"TABLE_NAME"`
+			Collation sql.NullString `db:"TABLE_COLLATION"`
+		}
+		err := h.selectIn(&tables, `SELECT TABLE_SCHEMA, TABLE_NAME, TABLE_COLLATION FROM information_schema.TABLES
+	WHERE TABLE_TYPE = 'BASE TABLE' AND TABLE_SCHEMA IN (?)`)
+		if err != nil {
+			return fmt.Errorf("failed to list tables: %w", err)
+		}
+		for _, v := range tables {
+			snapshot.table(v.Schema, v.Name).Collation = v.Collation.String
+		}
+
+		var columns []struct {
+			Schema    string         `db:"TABLE_SCHEMA"`
+			Table     string         `db:"TABLE_NAME"`
+			Name      string         `db:"COLUMN_NAME"`
+			Type      string         `db:"COLUMN_TYPE"`
+			Nullable  string         `db:"IS_NULLABLE"`
+			Collation sql.NullString `db:"COLLATION_NAME"`
+		}
+		err = h.selectIn(&columns, `SELECT c.TABLE_SCHEMA, c.TABLE_NAME, c.COLUMN_NAME, c.COLUMN_TYPE, c.IS_NULLABLE, c.COLLATION_NAME
+	FROM information_schema.COLUMNS c
+	JOIN information_schema.TABLES t ON t.TABLE_SCHEMA = c.TABLE_SCHEMA AND t.TABLE_NAME = c.TABLE_NAME
+	WHERE t.TABLE_TYPE = 'BASE TABLE' AND c.TABLE_SCHEMA IN (?)`)
+		if err != nil {
+			return fmt.Errorf("failed to list columns: %w", err)
+		}
+		for _, v := range columns {
+			snapshot.table(v.Schema, v.Table).Columns[v.Name] = columnSchema{
+				Type:      v.Type,
+				Nullable:  v.Nullable == "YES",
+				Collation: v.Collation.String,
+			}
+		}
+
+		var indexes []struct {
+			Schema    string `db:"TABLE_SCHEMA"`
+			Table     string `db:"TABLE_NAME"`
+			Name      string `db:"INDEX_NAME"`
+			NonUnique bool   `db:"NON_UNIQUE"`
+			Column    string `db:"COLUMN_NAME"`
+		}
+		err = h.selectIn(&indexes, `SELECT TABLE_SCHEMA, TABLE_NAME, INDEX_NAME, NON_UNIQUE, COLUMN_NAME
+	FROM information_schema.STATISTICS WHERE TABLE_SCHEMA IN (?)
+	ORDER BY TABLE_SCHEMA, TABLE_NAME, INDEX_NAME, SEQ_IN_INDEX`)
+		if err != nil {
+			return fmt.Errorf("failed to list indexes: %w", err)
+		}
+		for _, v := range indexes {
+			t := snapshot.table(v.Schema, v.Table)
+			index := t.Indexes[v.Name]
+			index.Columns = append(index.Columns, v.Column)
+			index.Unique = !v.NonUnique
+			t.Indexes[v.Name] = index
+		}
+		return nil
+	})
+	return snapshot, err
+}
+
+// selectIn runs a query whose single IN (?) is bound to the policy schemas
+func (h handler) selectIn(dest interface{}, query string) error {
+	query, args, err := sqlx.In(query, h.policy.Schemas)
+	if err != nil {
+		return err
+	}
+	return h.db.Select(dest, query, args...)
+}
+
+// expectedSchema loads the snapshot recorded for a schema version, nil when
+// there is none
+func (h handler) expectedSchema(version string) (snapshot schemaSnapshot, err error) {
+	err = h.probe("expected_schema/"+version, &snapshot, func() error {
+		f, err := os.Open(filepath.Join(h.policy.SchemaDir, version+".json"))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return json.NewDecoder(f).Decode(&snapshot)
+	})
+	return snapshot, err
+}
+
+type schemaDriftCheck struct{ h handler }
+
+func (schemaDriftCheck) ID() string { return "schema_drift" }
+func (schemaDriftCheck) Description() string {
+	return "live tables match the expected schema of the recorded schema version"
+}
+func (schemaDriftCheck) Severity() Severity { return SeverityWarning }
+
+func (c schemaDriftCheck) Run(ctx context.Context) (findings []Finding, err error) {
+	if c.h.policy.SchemaDir == "" {
+		return nil, nil
+	}
+	version := c.h.schemaversion()
+	if version == "" {
+		return nil, fmt.Errorf("no schema version recorded")
+	}
+	expected, err := c.h.expectedSchema(version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load expected schema %s: %w", version, err)
+	}
+	if expected == nil {
+		f := newFinding(c, version, "no expected schema snapshot for schema version %s", version)
+		f.Severity = SeverityInfo
+		return []Finding{f}, nil
+	}
+	live, err := c.h.liveSchema()
+	if err != nil {
+		return nil, err
+	}
+	for _, schema := range c.h.policy.Schemas {
+		for _, d := range diffSchema(expected[schema], live[schema]) {
+			findings = append(findings, newFinding(c, d.kind+" "+schema+"."+d.subject, "%s (schema version %s)", d.change, version))
+		}
+	}
+	return findings, nil
+}
+
+// schemaChange is a change to a table, column or index, kind keeps an index
+// named after its column apart from the column
+type schemaChange struct {
+	kind    string
+	subject string
+	change  string
+}
+
+// diffSchema lists the objects added, removed or changed from expected to live
+func diffSchema(expected, live map[string]*tableSchema) (changes []schemaChange) {
+	for _, name := range unionKeys(expected, live) {
+		want, got := expected[name], live[name]
+		switch {
+		case got == nil:
+			changes = append(changes, schemaChange{"table", name, "table removed"})
+			continue
+		case want == nil:
+			changes = append(changes, schemaChange{"table", name, "table added"})
+			continue
+		}
+		if want.Collation != got.Collation {
+			changes = append(changes, schemaChange{"table", name, fmt.Sprintf("collation changed from %s to %s", want.Collation, got.Collation)})
+		}
+		for _, col := range unionKeys(want.Columns, got.Columns) {
+			w, wok := want.Columns[col]
+			g, gok := got.Columns[col]
+			subject := name + "." + col
+			switch {
+			case !gok:
+				changes = append(changes, schemaChange{"column", subject, "column removed"})
+			case !wok:
+				changes = append(changes, schemaChange{"column", subject, fmt.Sprintf("column added %s", g.Type)})
+			case w != g:
+				changes = append(changes, schemaChange{"column", subject, fmt.Sprintf("column changed from %s to %s", w, g)})
+			}
+		}
+		for _, idx := range unionKeys(want.Indexes, got.Indexes) {
+			w, wok := want.Indexes[idx]
+			g, gok := got.Indexes[idx]
+			subject := name + "." + idx
+			switch {
+			case !gok:
+				changes = append(changes, schemaChange{"index", subject, "index removed"})
+			case !wok:
+				changes = append(changes, schemaChange{"index", subject, fmt.Sprintf("index added %s", g)})
+			case !reflect.DeepEqual(w, g):
+				changes = append(changes, schemaChange{"index", subject, fmt.Sprintf("index changed from %s to %s", w, g)})
+			}
+		}
+	}
+	return changes
+}
+
+func (c columnSchema) String() string {
+	s := c.Type
+	if c.Collation != "" {
+		s += " COLLATE " + c.Collation
+	}
+	if !c.Nullable {
+		s += " NOT NULL"
+	}
+	return s
+}
+
+func (i indexSchema) String() string {
+	s := "(" + strings.Join(i.Columns, ", ") + ")"
+	if i.Unique {
+		s = "UNIQUE " + s
+	}
+	return s
+}
+
+// unionKeys returns the sorted keys of two maps with the same key type
+func unionKeys(a, b interface{}) (keys []string) {
+	seen := map[string]bool{}
+	for _, m := range []interface{}{a, b} {
+		for _, k := range reflect.ValueOf(m).MapKeys() {
+			if !seen[k.String()] {
+				seen[k.String()] = true
+				keys = append(keys, k.String())
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// dumpSchema writes the live schema of the first target as the expected
+// snapshot for its schema version
+func dumpSchema(args []string) int {
+	f, err := newFleet()
+	if err != nil {
+		log.WithError(err).Error("error setting configuration")
+		return 2
+	}
+	defer f.Close()
+
+	h := f[0]
+	snapshot, err := h.liveSchema()
+	if err != nil {
+		log.WithError(err).Error("failed to read schema")
+		return 1
+	}
+	log.Infof("schema version: %s", h.schemaversion())
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(snapshot)
+	if err != nil {
+		log.WithError(err).Error("failed to write schema")
+		return 1
+	}
+	return 0
+}
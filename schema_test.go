@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDiffSchema(t *testing.T) {
+	profiles := func() *tableSchema {
+		return &tableSchema{
+			Collation: "utf8mb4_unicode_520_ci",
+			Columns: map[string]columnSchema{
+				"userid":     {Type: "mediumint(9)"},
+				"login_name": {Type: "varchar(255)", Collation: "utf8mb4_unicode_520_ci"},
+			},
+			Indexes: map[string]indexSchema{
+				"PRIMARY":                 {Columns: []string{"userid"}, Unique: true},
+				"profiles_login_name_idx": {Columns: []string{"login_name"}, Unique: true},
+			},
+		}
+	}
+	tests := []struct {
+		name   string
+		change func(live map[string]*tableSchema)
+		want   []string
+	}{
+		{
+			name:   "no changes",
+			change: func(live map[string]*tableSchema) {},
+		},
+		{
+			name: "column type changed",
+			change: func(live map[string]*tableSchema) {
+				live["profiles"].Columns["userid"] = columnSchema{Type: "int(11)"}
+			},
+			want: []string{"profiles.userid: column changed from mediumint(9) NOT NULL to int(11) NOT NULL"},
+		},
+		{
+			name: "column made nullable",
+			change: func(live map[string]*tableSchema) {
+				live["profiles"].Columns["userid"] = columnSchema{Type: "mediumint(9)", Nullable: true}
+			},
+			want: []string{"profiles.userid: column changed from mediumint(9) NOT NULL to mediumint(9)"},
+		},
+		{
+			name: "columns added and removed",
+			change: func(live map[string]*tableSchema) {
+				delete(live["profiles"].Columns, "login_name")
+				live["profiles"].Columns["realname"] = columnSchema{Type: "varchar(255)"}
+			},
+			want: []string{
+				"profiles.login_name: column removed",
+				"profiles.realname: column added varchar(255)",
+			},
+		},
+		{
+			name: "index changed",
+			change: func(live map[string]*tableSchema) {
+				live["profiles"].Indexes["profiles_login_name_idx"] = indexSchema{Columns: []string{"login_name"}}
+			},
+			want: []string{"profiles.profiles_login_name_idx: index changed from UNIQUE (login_name) to (login_name)"},
+		},
+		{
+			name: "collation changed",
+			change: func(live map[string]*tableSchema) {
+				live["profiles"].Collation = "utf8_general_ci"
+			},
+			want: []string{"profiles: collation changed from utf8mb4_unicode_520_ci to utf8_general_ci"},
+		},
+		{
+			name: "tables added and removed",
+			change: func(live map[string]*tableSchema) {
+				live["groups"] = live["profiles"]
+				delete(live, "profiles")
+			},
+			want: []string{"groups: table added", "profiles: table removed"},
+		},
+	}
+	for _, tt := range tests {
+		expected := map[string]*tableSchema{"profiles": profiles()}
+		live := map[string]*tableSchema{"profiles": profiles()}
+		tt.change(live)
+		var got []string
+		for _, d := range diffSchema(expected, live) {
+			got = append(got, d.subject+": "+d.change)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestExpectedSchemaFromBundle(t *testing.T) {
+	var b bundle
+	b.Policy.SchemaDir = "/nonexistent"
+	b.Probes = map[string]probeResult{
+		"expected_schema/23": {Value: json.RawMessage(`{"bugzilla":{"profiles":{"collation":"utf8mb4_unicode_520_ci"}}}`)},
+		"expected_schema/24": {Value: json.RawMessage(`null`)},
+	}
+	h, err := fromBundle(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := h.expectedSchema("23")
+	if err != nil || expected.table("bugzilla", "profiles") == nil {
+		t.Errorf("expectedSchema(23) = %v, %v, want the bundled profiles table", expected, err)
+	}
+	expected, err = h.expectedSchema("24")
+	if err != nil || expected != nil {
+		t.Errorf("expectedSchema(24) = %v, %v, want none", expected, err)
+	}
+	if _, err = h.expectedSchema("25"); err == nil {
+		t.Error("expectedSchema(25) succeeded without a bundled snapshot")
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+)
+
+// describeClusterProbe is kept as the bundle's dbinfo rather than a probe
+const describeClusterProbe = "describe_cluster"
+
+// probeResult is what a probe read, or the error it failed with
+type probeResult struct {
+	Value json.RawMessage `json:"value,omitempty"`
+	Error string          `json:"error,omitempty"`
+}
+
+// probeRecorder captures every probe of a handler into a bundle, or answers
+// them from one instead of AWS and the database
+type probeRecorder struct {
+	mu     sync.Mutex
+	replay bool
+	probes map[string]probeResult
+}
+
+// probe runs fn to fill dest, recording the result when capturing a snapshot
+// or decoding the recorded result instead when linting one
+func (h handler) probe(key string, dest interface{}, fn func() error) error {
+	r := h.recorder
+	if r == nil {
+		return fn()
+	}
+	if r.replay {
+		r.mu.Lock()
+		result, ok := r.probes[key]
+		r.mu.Unlock()
+		if !ok {
+			return fmt.Errorf("%s is not in the snapshot", key)
+		}
+		if result.Error != "" {
+			return errors.New(result.Error)
+		}
+		return json.Unmarshal(result.Value, dest)
+	}
+
+	var result probeResult
+	probeErr := fn()
+	if probeErr != nil {
+		result.Error = probeErr.Error()
+	} else {
+		value, err := json.Marshal(dest)
+		if err != nil {
+			return fmt.Errorf("failed to record %s: %w", key, err)
+		}
+		result.Value = value
+	}
+	r.mu.Lock()
+	r.probes[key] = result
+	r.mu.Unlock()
+	return probeErr
+}
+
+// bundle is everything the checks read from a target, enough to lint it again
+// without AWS or the database
+type bundle struct {
+	Taken         time.Time              `json:"taken"`
+	Version       string                 `json:"version"`
+	Commit        string                 `json:"commit"`
+	Name          string                 `json:"name"`
+	AccountID     string                 `json:"account_id"`
+	Cluster       string                 `json:"cluster"`
+	LambdaInvoker string                 `json:"lambda_invoker"`
+	Policy        policy                 `json:"policy"`
+	DBInfo        dbinfo                 `json:"dbinfo"`
+	Findings      []Finding              `json:"findings"`
+	Probes        map[string]probeResult `json:"probes"`
+}
+
+// capture runs every registered check, including disabled ones so the bundle
+// is complete, recording what they read. It samples uptimes and row counts
+// afresh and keeps no history, so taking a bundle leaves a live deployment
+// untouched.
+func (h handler) capture(ctx context.Context) (b bundle, err error) {
+	h.recorder = &probeRecorder{probes: map[string]probeResult{}}
+	h.uptimes = newUptimeTracker()
+	h.rowCounts = newRowCounter()
+	h.history = nil
+	b = bundle{
+		Taken:         time.Now(),
+		Version:       version,
+		Commit:        commit,
+		Name:          h.Name,
+		AccountID:     h.AccountID,
+		Cluster:       h.Cluster,
+		LambdaInvoker: h.LambdaInvoker,
+		Policy:        h.policy,
+	}
+	// notifiers hold SMTP credentials and webhook URLs, and linting never
+	// notifies
+	b.Policy.Notify = nil
+	b.DBInfo, err = h.describeCluster(ctx)
+	if err != nil {
+		return b, fmt.Errorf("failed to describe cluster: %w", err)
+	}
+	// the bundle's description stays out of the live handlers
+	h.dbInfo = &latestInfo{info: b.DBInfo}
+
+	b.Findings = h.runChecks(ctx)
+	for _, factory := range registry {
+		c := factory(h)
+		if h.policy.disabled(c.ID()) {
+			if _, err := c.Run(ctx); err != nil {
+				log.WithError(err).WithField("check", c.ID()).Warn("disabled check failed to run")
+			}
+		}
+	}
+
+	b.Probes = h.recorder.probes
+	delete(b.Probes, describeClusterProbe)
+	return b, nil
+}
+
+// fromBundle is a handler that answers every probe from the bundle and
+// judges it by the policy it was captured with
+func fromBundle(b bundle) (h handler, err error) {
+	probes := map[string]probeResult{}
+	for k, v := range b.Probes {
+		probes[k] = v
+	}
+	dbInfo, err := json.Marshal(b.DBInfo)
+	if err != nil {
+		return h, err
+	}
+	probes[describeClusterProbe] = probeResult{Value: dbInfo}
+
+	name := b.Name
+	if name == "" {
+		name = b.Cluster
+	}
+	return handler{
+		Name:          name,
+		AccountID:     b.AccountID,
+		Cluster:       b.Cluster,
+		clusterID:     b.Cluster,
+		LambdaInvoker: b.LambdaInvoker,
+		policy:        b.Policy,
+		uptimes:       newUptimeTracker(),
+		rowCounts:     newRowCounter(),
+		recorder:      &probeRecorder{replay: true, probes: probes},
+		dbInfo:        &latestInfo{info: b.DBInfo},
+	}, nil
+}
+
+// loadBundles builds a fleet from snapshot files
+func loadBundles(paths []string) (f fleet, err error) {
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		var b bundle
+		err = json.NewDecoder(file).Decode(&b)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		h, err := fromBundle(b)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s: %w", path, err)
+		}
+		log.WithFields(log.Fields{
+			"account": h.AccountID,
+			"cluster": h.Cluster,
+			"taken":   b.Taken,
+		}).Info("linting snapshot")
+		f = append(f, h)
+	}
+	return f, nil
+}
+
+// snapshot writes a bundle of a target to stdout
+func snapshot(args []string) int {
+	fs := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	cluster := fs.String("cluster", "", "name of the target to capture, defaults to the first")
+	fs.Parse(args)
+
+	f, err := newFleet()
+	if err != nil {
+		log.WithError(err).Error("error setting configuration")
+		return 2
+	}
+	defer f.Close()
+
+	h, err := f.named(*cluster)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	b, err := h.capture(context.Background())
+	if err != nil {
+		log.WithError(err).Error("failed to capture snapshot")
+		return 1
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(b)
+	if err != nil {
+		log.WithError(err).Error("failed to write snapshot")
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+func init() {
+	register(func(h handler) Check { return headroomCheck{h} })
+}
+
+// integerMax is the largest signed value of each integer type, unsigned
+// columns can hold twice as much plus one
+var integerMax = map[string]float64{
+	"tinyint":   math.MaxInt8,
+	"smallint":  math.MaxInt16,
+	"mediumint": 1<<23 - 1,
+	"int":       math.MaxInt32,
+	"bigint":    math.MaxInt64,
+}
+
+// autoIncrement is the headroom left in a table's auto_increment key
+type autoIncrement struct {
+	Schema        string  `db:"TABLE_SCHEMA" json:"schema"`
+	Table         string  `db:"TABLE_NAME" json:"table"`
+	Column        string  `db:"COLUMN_NAME" json:"column"`
+	DataType      string  `db:"DATA_TYPE" json:"data_type"`
+	ColumnType    string  `db:"COLUMN_TYPE" json:"column_type"`
+	AutoIncrement uint64  `db:"AUTO_INCREMENT" json:"auto_increment"`
+	Max           float64 `db:"-" json:"max"`
+	Used          float64 `db:"-" json:"used"`
+}
+
+func (a autoIncrement) Unsigned() bool {
+	return strings.Contains(a.ColumnType, "unsigned")
+}
+
+// measure sets the maximum of the key's type and how much of it is used, a key
+// of a non integer type is left unmeasured
+func (a *autoIncrement) measure() {
+	max, ok := integerMax[a.DataType]
+	if !ok {
+		return
+	}
+	if a.Unsigned() {
+		max = max*2 + 1
+	}
+	a.Max = max
+	// AUTO_INCREMENT is the next id to be handed out
+	a.Used = float64(a.AutoIncrement-1) / max
+}
+
+type headroomCheck struct{ h handler }
+
+func (headroomCheck) ID() string { return "table_id_limits" }
+func (headroomCheck) Description() string {
+	return "auto_increment keys have headroom before their type's maximum"
+}
+func (headroomCheck) Severity() Severity { return SeverityWarning }
+
+func (c headroomCheck) Run(ctx context.Context) (findings []Finding, err error) {
+	p := c.h.policy
+	keys, err := c.h.autoIncrements()
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range keys {
+		if v.Used < p.HeadroomWarning {
+			continue
+		}
+		f := newFinding(c, v.Schema+"."+v.Table, "%s %s is %.1f%% used, next id %d of %.0f", v.Column, v.ColumnType, v.Used*100, v.AutoIncrement, v.Max)
+		if v.Used >= p.HeadroomCritical {
+			f.Severity = SeverityCritical
+		}
+		findings = append(findings, f)
+	}
+	return findings, nil
+}
+
+// autoIncrements computes how much of its type's range every auto_increment
+// key has used, most used first
+func (h handler) autoIncrements() (keys []autoIncrement, err error) {
+	err = h.probe("auto_increments", &keys, func() error {
+		err = h.db.Select(&keys, `SELECT c.TABLE_SCHEMA, c.TABLE_NAME, c.COLUMN_NAME, c.DATA_TYPE, c.COLUMN_TYPE, t.AUTO_INCREMENT
+	FROM information_schema.COLUMNS c
+	JOIN information_schema.TABLES t ON t.TABLE_SCHEMA = c.TABLE_SCHEMA AND t.TABLE_NAME = c.TABLE_NAME
+	WHERE c.EXTRA LIKE '%auto_increment%'
+	AND t.AUTO_INCREMENT IS NOT NULL
+	AND c.TABLE_SCHEMA NOT IN ('mysql', 'sys', 'information_schema', 'performance_schema')`)
+		if err != nil {
+			return fmt.Errorf("failed to list auto_increment columns: %w", err)
+		}
+		for i := range keys {
+			keys[i].measure()
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].Used > keys[j].Used
+		})
+		return nil
+	})
+	return keys, err
+}
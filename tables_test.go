@@ -0,0 +1,33 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAutoIncrementMeasure(t *testing.T) {
+	tests := []struct {
+		dataType, columnType string
+		next                 uint64
+		max, used            float64
+	}{
+		{"int", "int(11)", 1, math.MaxInt32, 0},
+		{"int", "int(11)", 1 << 30, math.MaxInt32, float64(1<<30-1) / math.MaxInt32},
+		{"int", "int(10) unsigned", 1 << 31, math.MaxUint32, float64(1<<31-1) / math.MaxUint32},
+		{"tinyint", "tinyint(3) unsigned", 256, math.MaxUint8, 1},
+		{"smallint", "smallint(6)", 32768, math.MaxInt16, 1},
+		{"mediumint", "mediumint(8) unsigned", 1 << 23, 1<<24 - 1, float64(1<<23-1) / (1<<24 - 1)},
+		{"bigint", "bigint(20)", 1 << 62, math.MaxInt64, 0.5},
+		// an unsigned bigint can hold the full 64 bits
+		{"bigint", "bigint(20) unsigned", 1 << 63, math.MaxUint64, 0.5},
+		{"bigint", "bigint(20) unsigned", math.MaxUint64, math.MaxUint64, 1},
+		{"decimal", "decimal(20,0)", 100, 0, 0},
+	}
+	for _, tt := range tests {
+		a := autoIncrement{DataType: tt.dataType, ColumnType: tt.columnType, AutoIncrement: tt.next}
+		a.measure()
+		if a.Max != tt.max || math.Abs(a.Used-tt.used) > 1e-9 {
+			t.Errorf("%s next %d: max %.0f used %g, want max %.0f used %g", tt.columnType, tt.next, a.Max, a.Used, tt.max, tt.used)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/aws/endpoints"
+)
+
+// target is a cluster to lint and how to reach it
+type target struct {
+	// Name selects the target with ?cluster=, defaults to the cluster identifier
+	Name string `json:"name"`
+	// Profile is the shared config profile to load credentials from
+	Profile string `json:"profile"`
+	// RoleARN is assumed on top of the profile's credentials when set
+	RoleARN string `json:"role_arn"`
+	Region  string `json:"region"`
+	// Cluster is the DBClusterIdentifier, otherwise Host is resolved via Route53
+	Cluster string `json:"cluster"`
+	// Host is the DNS name of the cluster, defaults to the account's auroradb
+	Host string `json:"host"`
+	// DSNSecret names the SSM parameter holding a complete DSN, otherwise one
+	// is built from MYSQL_ROOT_PASSWORD
+	DSNSecret string `json:"dsn_secret"`
+	// PolicyFile and Policy override the expected values for this target
+	PolicyFile string          `json:"policy_file"`
+	Policy     json.RawMessage `json:"policy"`
+}
+
+var defaultTargets = []target{{
+	Profile: "uneet-prod",
+	Region:  endpoints.ApSoutheast1RegionID,
+}}
+
+// loadTargets reads the JSON target list named by DBCHECK_TARGETS
+func loadTargets() ([]target, error) {
+	path := os.Getenv("DBCHECK_TARGETS")
+	if path == "" {
+		return defaultTargets, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var targets []target
+	err = json.NewDecoder(f).Decode(&targets)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no targets in %s", path)
+	}
+	for i := range targets {
+		if targets[i].Region == "" {
+			targets[i].Region = endpoints.ApSoutheast1RegionID
+		}
+	}
+	return targets, nil
+}
+
+// fleet is every cluster a dbcheck deployment lints, the first is the home
+// cluster whose API_ACCESS_TOKEN protects the HTTP endpoints
+type fleet []handler
+
+func newFleet() (f fleet, err error) {
+	targets, err := loadTargets()
+	if err != nil {
+		return nil, err
+	}
+	var history *historyStore
+	if path := historyPath(); path != "" {
+		history, err = openHistory(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open history: %w", err)
+		}
+	}
+	notifications := newNotifyQueue()
+	for _, t := range targets {
+		h, err := New(t)
+		if err != nil {
+			f.Close()
+			notifications.close()
+			return nil, fmt.Errorf("failed to set up %s: %w", t.Name, err)
+		}
+		h.history = history
+		if len(h.policy.Notify) > 0 && !canNotify() {
+			log.WithField("cluster", h.Cluster).Error("not notifying, on Lambda DBCHECK_HISTORY must name storage every container shares")
+		} else {
+			h.notifications = notifications
+		}
+		log.WithFields(log.Fields{
+			"account": h.AccountID,
+			"cluster": h.Cluster,
+		}).Info("linting")
+		f = append(f, h)
+	}
+	return f, nil
+}
+
+func (f fleet) Close() {
+	for _, h := range f {
+		// handlers linting a snapshot have no database
+		if h.db != nil {
+			h.db.Close()
+		}
+	}
+	// the handlers share one queue, delivering what is left before exiting
+	if len(f) > 0 && f[0].notifications != nil {
+		f[0].notifications.close()
+	}
+}
+
+// named selects a handler by name, defaulting to the first
+func (f fleet) named(name string) (handler, error) {
+	if name == "" {
+		return f[0], nil
+	}
+	for _, h := range f {
+		if h.Name == name {
+			return h, nil
+		}
+	}
+	return handler{}, fmt.Errorf("unknown cluster %q", name)
+}
+
+// pick selects the handler named by ?cluster=, defaulting to the first
+func (f fleet) pick(w http.ResponseWriter, r *http.Request) (handler, bool) {
+	h, err := f.named(r.URL.Query().Get("cluster"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return h, false
+	}
+	return h, true
+}
+
+// route serves a handler method against the cluster picked by the request
+func (f fleet) route(fn func(h handler, w http.ResponseWriter, r *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h, ok := f.pick(w, r)
+		if !ok {
+			return
+		}
+		fn(h, w, r)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func init() {
+	register(func(h handler) Check { return triggerCheck{h} })
+}
+
+// trigger is a row of information_schema.TRIGGERS
+type trigger struct {
+	Schema              string `db:"TRIGGER_SCHEMA" json:"schema"`
+	Name                string `db:"TRIGGER_NAME" json:"name"`
+	Table               string `db:"EVENT_OBJECT_TABLE" json:"table"`
+	Event               string `db:"EVENT_MANIPULATION" json:"event"`
+	Timing              string `db:"ACTION_TIMING" json:"timing"`
+	Definer             string `db:"DEFINER" json:"definer,omitempty"`
+	CharacterSetClient  string `db:"CHARACTER_SET_CLIENT" json:"character_set_client,omitempty"`
+	CollationConnection string `db:"COLLATION_CONNECTION" json:"collation_connection,omitempty"`
+	DatabaseCollation   string `db:"DATABASE_COLLATION" json:"database_collation,omitempty"`
+}
+
+func (t trigger) String() string {
+	return fmt.Sprintf("%s.%s", t.Schema, t.Name)
+}
+
+type triggerCheck struct{ h handler }
+
+func (triggerCheck) ID() string { return "triggers" }
+func (triggerCheck) Description() string {
+	return "the expected triggers exist with the right timing and character set"
+}
+func (triggerCheck) Severity() Severity { return SeverityCritical }
+
+func (c triggerCheck) Run(ctx context.Context) (findings []Finding, err error) {
+	p := c.h.policy
+	triggers, err := c.h.triggers()
+	if err != nil {
+		return nil, err
+	}
+
+	live := map[string]trigger{}
+	for _, t := range triggers {
+		live[t.String()] = t
+		if t.CharacterSetClient != p.CharacterSet || t.DatabaseCollation != p.Collation {
+			f := newFinding(c, t.String(), "definer %s CharacterSetClient: %s DatabaseCollation: %s", t.Definer, t.CharacterSetClient, t.DatabaseCollation).withKind("charset")
+			f.Severity = SeverityWarning
+			findings = append(findings, f)
+		}
+	}
+
+	// only schemas with expectations are compared so an empty policy does
+	// not report every trigger as extra
+	expectedSchemas := map[string]bool{}
+	expected := map[string]bool{}
+	for _, want := range p.Triggers {
+		expectedSchemas[want.Schema] = true
+		expected[want.String()] = true
+		got, ok := live[want.String()]
+		if !ok {
+			findings = append(findings, newFinding(c, want.String(), "missing %s %s trigger on %s", want.Timing, want.Event, want.Table).withKind("definition"))
+			continue
+		}
+		if !strings.EqualFold(got.Table, want.Table) || !strings.EqualFold(got.Timing, want.Timing) || !strings.EqualFold(got.Event, want.Event) {
+			findings = append(findings, newFinding(c, want.String(), "is %s %s on %s, expected %s %s on %s (definer %s)",
+				got.Timing, got.Event, got.Table, want.Timing, want.Event, want.Table, got.Definer).withKind("definition"))
+		}
+	}
+	for _, t := range triggers {
+		if expectedSchemas[t.Schema] && !expected[t.String()] {
+			f := newFinding(c, t.String(), "unexpected %s %s trigger on %s (definer %s)", t.Timing, t.Event, t.Table, t.Definer).withKind("definition")
+			f.Severity = SeverityWarning
+			findings = append(findings, f)
+		}
+	}
+	return findings, nil
+}
+
+// triggers lists the triggers of the policy schemas
+func (h handler) triggers() (triggers []trigger, err error) {
+	err = h.probe("triggers", &triggers, func() error {
+		query, args, err := sqlx.In(`SELECT TRIGGER_SCHEMA, TRIGGER_NAME, EVENT_OBJECT_TABLE, EVENT_MANIPULATION, ACTION_TIMING,
+	DEFINER, CHARACTER_SET_CLIENT, COLLATION_CONNECTION, DATABASE_COLLATION
+	FROM information_schema.TRIGGERS WHERE TRIGGER_SCHEMA IN (?)
+	ORDER BY TRIGGER_SCHEMA, TRIGGER_NAME`, h.policy.Schemas)
+		if err != nil {
+			return err
+		}
+		err = h.db.Select(&triggers, query, args...)
+		if err != nil {
+			return fmt.Errorf("failed to list triggers: %w", err)
+		}
+		return nil
+	})
+	return triggers, err
+}
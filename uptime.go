@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+)
+
+func init() {
+	register(func(h handler) Check { return uptimeCheck{h} })
+}
+
+// restartMemory is how long a detected restart keeps being reported
+const restartMemory = 24 * time.Hour
+
+// restart is a reboot of an instance between two evaluations
+type restart struct {
+	Instance string
+	Booted   time.Time
+	// Since is when the instance was last seen running before the restart
+	Since  time.Time
+	Events []rds.Event
+}
+
+// uptimeTracker remembers when instances booted across evaluations
+type uptimeTracker struct {
+	mu       sync.Mutex
+	booted   map[string]time.Time
+	seen     map[string]time.Time
+	restarts []restart
+}
+
+func newUptimeTracker() *uptimeTracker {
+	return &uptimeTracker{booted: map[string]time.Time{}, seen: map[string]time.Time{}}
+}
+
+// observe records an uptime reading, returning a restart when the instance
+// booted after it was last seen
+func (t *uptimeTracker) observe(instance string, uptime time.Duration, now time.Time) (r restart, restarted bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	booted := now.Add(-uptime)
+	last, ok := t.booted[instance]
+	// allow for clock skew and rounding of Uptime to the second
+	if ok && booted.Sub(last) > time.Minute {
+		r = restart{Instance: instance, Booted: booted, Since: t.seen[instance]}
+		restarted = true
+	}
+	t.booted[instance] = booted
+	t.seen[instance] = now
+	return r, restarted
+}
+
+func (t *uptimeTracker) record(r restart) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.restarts = append(t.restarts, r)
+}
+
+// recent lists the restarts detected within restartMemory
+func (t *uptimeTracker) recent(now time.Time) (rr []restart) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var kept []restart
+	for _, r := range t.restarts {
+		if now.Sub(r.Booted) < restartMemory {
+			kept = append(kept, r)
+		}
+	}
+	t.restarts = kept
+	return append(rr, kept...)
+}
+
+type uptimeCheck struct{ h handler }
+
+func (uptimeCheck) ID() string { return "uptime" }
+func (uptimeCheck) Description() string {
+	return "instances have not restarted unexpectedly since the last evaluation"
+}
+func (uptimeCheck) Severity() Severity { return SeverityWarning }
+
+func (c uptimeCheck) Run(ctx context.Context) (findings []Finding, err error) {
+	uptimes, err := c.h.instanceUptimes()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for instance, uptime := range uptimes {
+		r, restarted := c.h.uptimes.observe(instance, uptime, now)
+		if !restarted {
+			continue
+		}
+		r.Events, err = c.h.instanceEvents(ctx, instance, r.Since, now)
+		if err != nil {
+			log.WithError(err).WithField("instance", instance).Error("failed to describe events")
+		}
+		c.h.uptimes.record(r)
+	}
+
+	for _, r := range c.h.uptimes.recent(now) {
+		var messages []string
+		crashed := false
+		for _, e := range r.Events {
+			msg := aws.StringValue(e.Message)
+			messages = append(messages, msg)
+			for _, category := range e.EventCategories {
+				if category == "failure" || category == "recovery" || category == "failover" {
+					crashed = true
+				}
+			}
+		}
+		f := newFinding(c, r.Instance, "restarted at %s with no RDS event, an unexpected restart", r.Booted.Format(time.RFC3339)).withKind(r.Booted.Format(time.RFC3339))
+		switch {
+		case crashed:
+			f.Severity = SeverityCritical
+			f.Message = fmt.Sprintf("crashed and restarted at %s: %s", r.Booted.Format(time.RFC3339), strings.Join(messages, "; "))
+		case len(messages) > 0:
+			f.Severity = SeverityInfo
+			f.Message = fmt.Sprintf("restarted at %s: %s", r.Booted.Format(time.RFC3339), strings.Join(messages, "; "))
+		}
+		findings = append(findings, f)
+	}
+	return findings, nil
+}
+
+// instanceUptimes reads Uptime from every cluster member
+func (h handler) instanceUptimes() (uptimes map[string]time.Duration, err error) {
+	err = h.probe("uptimes", &uptimes, func() error {
+		uptimes = map[string]time.Duration{}
+		for _, db := range h.dbInfo.get().DBs {
+			if db.Endpoint == nil {
+				continue
+			}
+			instance := *db.DBInstanceIdentifier
+			uptime, err := h.instanceUptime(fmt.Sprintf("%s:%d", *db.Endpoint.Address, aws.Int64Value(db.Endpoint.Port)))
+			if err != nil {
+				return fmt.Errorf("failed to get uptime of %s: %w", instance, err)
+			}
+			uptimes[instance] = uptime
+		}
+		return nil
+	})
+	return uptimes, err
+}
+
+func (h handler) instanceUptime(addr string) (uptime time.Duration, err error) {
+	cfg, err := mysql.ParseDSN(h.DSN)
+	if err != nil {
+		return 0, err
+	}
+	cfg.Addr = addr
+	db, err := sqlx.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	var status struct {
+		Name  string `db:"Variable_name"`
+		Value int64  `db:"Value"`
+	}
+	err = db.Get(&status, "SHOW GLOBAL STATUS LIKE 'Uptime'")
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(status.Value) * time.Second, nil
+}
+
+// instanceEvents lists the RDS events of an instance between start and end
+func (h handler) instanceEvents(ctx context.Context, instance string, start, end time.Time) (events []rds.Event, err error) {
+	err = h.probe("events/"+instance, &events, func() error {
+		rdsapi := rds.New(h.AWSCfg)
+		req := rdsapi.DescribeEventsRequest(&rds.DescribeEventsInput{
+			SourceIdentifier: aws.String(instance),
+			SourceType:       rds.SourceTypeDbInstance,
+			StartTime:        aws.Time(start),
+			EndTime:          aws.Time(end),
+		})
+		p := rds.NewDescribeEventsPaginator(req)
+		for p.Next(ctx) {
+			events = append(events, p.CurrentPage().Events...)
+		}
+		return p.Err()
+	})
+	return events, err
+}